@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/hjson/hjson-go/v4"
+	"github.com/urfave/cli/v2"
+
+	"github.com/markeissler/injector/pkg/codegen"
+	"github.com/markeissler/injector/pkg/docgen"
+	"github.com/markeissler/injector/pkg/jsonutil"
+)
+
+// codegenCommand defines the command that generates a typed configuration loader for the environment variables of a
+// secret document, so that renamed or removed variables break builds instead of failing at runtime.
+func codegenCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "codegen",
+		Usage:     "Generate a typed configuration loader for the environment variables of the secret document.",
+		ArgsUsage: "[FILE]",
+		Description: "Writes code for a typed configuration loader, with one field per environment variable generated " +
+			"from the secret document specified by the global options, or read from FILE, to stdout. Field types are " +
+			"inferred from the document values.",
+		Flags: []cli.Flag{
+			// lang sets the programming language of the generated code.
+			&cli.StringFlag{
+				Name:     "lang",
+				Usage:    fmt.Sprintf("Language of the generated code (%s).", strings.Join(codegen.Languages(), ", ")),
+				Required: true,
+			},
+			// package sets the name of the generated Go package.
+			&cli.StringFlag{
+				Name:     "package",
+				Usage:    "Name of the generated Go package. (\"config\" if not specified)",
+				Required: false,
+			},
+			// schema reads a JSON Schema (e.g. as written by the docs command) describing the environment variables part
+			// of the secret document instead of the document itself.
+			&cli.BoolFlag{
+				Name:     "schema",
+				Usage:    "Read a JSON Schema describing the environment variables instead of the secret document.",
+				Required: false,
+			},
+		},
+		Action: runCodegen,
+	}
+}
+
+// runCodegen is the main loop for the `codegen` command.
+func runCodegen(ctx *cli.Context) error {
+	if err := generateCode(ctx, os.Stdout); err != nil {
+		return cli.Exit(err.Error(), 1)
+	}
+
+	return nil
+}
+
+// generateCode reads the secret manager document, or a JSON Schema describing it, from the file named by the command
+// argument or from secret manager, and writes the code for a typed configuration loader to the io.Writer. Like the
+// docs command, the document is read as written.
+func generateCode(ctx *cli.Context, writer io.Writer) error {
+	if bad, err := hasConflictingOptions(ctx); bad {
+		return err
+	}
+
+	language, err := codegen.ParseLanguage(ctx.String("lang"))
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	if err = readCommandDocument(ctx, &buf); err != nil {
+		return err
+	}
+
+	data, err := jsonutil.Parse(buf.Bytes())
+	if err != nil {
+		return err
+	}
+
+	var list []jsonutil.KeyValue
+	var describer codegen.Describer
+	if ctx.Bool("schema") {
+		list, describer, err = schemaVariables(ctx, data)
+	} else {
+		describer, err = docgen.Parse(buf.Bytes())
+		if err == nil {
+			list, err = documentVariables(ctx, data)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	return codegen.Generate(writer, language, codegen.Fields(list, describer), codegen.Options{Package: ctx.String("package")})
+}
+
+// schemaVariables returns the environment variables generated from a sample of the document described by the JSON
+// Schema, along with a Describer for their values. Only mappings specified by cli options are applied.
+func schemaVariables(ctx *cli.Context, schema *hjson.OrderedMap) ([]jsonutil.KeyValue, codegen.Describer, error) {
+	sample, describer, err := codegen.Sample(schema)
+	if err != nil {
+		return []jsonutil.KeyValue{}, describer, err
+	}
+
+	options, err := flattenOptions(ctx)
+	if err != nil {
+		return []jsonutil.KeyValue{}, describer, err
+	}
+
+	list, err := jsonutil.FlattenRoots(sample, []string{""}, options)
+	if err != nil {
+		return list, describer, err
+	}
+
+	mapping, err := documentMapping(ctx, hjson.NewOrderedMap())
+	if err != nil {
+		return list, describer, err
+	}
+
+	list, err = mapping.Apply(list, options)
+	return list, describer, err
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/hjson/hjson-go/v4"
+	"github.com/urfave/cli/v2"
+
+	"github.com/markeissler/injector/pkg/docgen"
+	"github.com/markeissler/injector/pkg/jsonutil"
+	"github.com/markeissler/injector/pkg/stringutil"
+)
+
+// docsCommand defines the command that generates documentation for the environment variables of a secret document from
+// the comments written in the document.
+func docsCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "docs",
+		Usage:     "Generate documentation and a JSON Schema skeleton from the comments in the secret document.",
+		ArgsUsage: "[FILE]",
+		Description: "Writes a Markdown table of the environment variable names generated from the secret document " +
+			"specified by the global options, or read from FILE, with the comments and types of their values (but " +
+			"never the values themselves) to stdout.",
+		Flags: []cli.Flag{
+			// schema-output represents the path to a file to which a JSON Schema skeleton, inferred from the types and
+			// comments of the values in the document, is written.
+			&cli.StringFlag{
+				Name:     "schema-output",
+				Usage:    "Write a JSON Schema skeleton inferred from the document to file.",
+				Required: false,
+			},
+		},
+		Action: runDocs,
+	}
+}
+
+// runDocs is the main loop for the `docs` command.
+func runDocs(ctx *cli.Context) error {
+	if err := docs(ctx, os.Stdout); err != nil {
+		return cli.Exit(err.Error(), 1)
+	}
+
+	return nil
+}
+
+// docs reads the secret manager document, from the file named by the command argument or from secret manager, and
+// writes a Markdown table describing its environment variables to the io.Writer. The document is described as written:
+// includes, conditional blocks and cross-secret references aren't resolved.
+func docs(ctx *cli.Context, writer io.Writer) error {
+	if bad, err := hasConflictingOptions(ctx); bad {
+		return err
+	}
+
+	var buf bytes.Buffer
+	if err := readCommandDocument(ctx, &buf); err != nil {
+		return err
+	}
+
+	document, err := docgen.Parse(buf.Bytes())
+	if err != nil {
+		return err
+	}
+
+	data, err := jsonutil.Parse(buf.Bytes())
+	if err != nil {
+		return err
+	}
+
+	list, err := documentVariables(ctx, data)
+	if err != nil {
+		return err
+	}
+
+	if err = docgen.WriteMarkdown(writer, document, list); err != nil {
+		return err
+	}
+
+	if schemaOutput := ctx.String("schema-output"); !stringutil.IsBlank(schemaOutput) {
+		var schema []byte
+		if schema, err = json.MarshalIndent(document.Schema(documentRoots(ctx)), "", jsonIndent); err != nil {
+			return err
+		}
+		if err = ioutil.WriteFile(schemaOutput, append(schema, '\n'), 0666); err != nil {
+			return fmt.Errorf("failed to write schema: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// documentVariables returns the environment variables generated from the parsed secret manager document, including
+// defaults and mapped names, without resolving their values: `$env` and `$file` value directives aren't read and values
+// aren't interpolated.
+func documentVariables(ctx *cli.Context, data *hjson.OrderedMap) ([]jsonutil.KeyValue, error) {
+	options, err := flattenOptions(ctx)
+	if err != nil {
+		return []jsonutil.KeyValue{}, err
+	}
+	options.LookupEnv = func(string) (string, bool) { return "", true }
+	options.ReadFile = func(string) ([]byte, error) { return []byte{}, nil }
+
+	list, err := jsonutil.FlattenRoots(data, documentRoots(ctx), options)
+	if err != nil {
+		return list, err
+	}
+
+	if value, ok := jsonutil.Get(data, defaultsRoot); ok {
+		if list, err = jsonutil.ApplyDefaults(list, value, defaultsRoot, options); err != nil {
+			return list, err
+		}
+	}
+
+	mapping, err := documentMapping(ctx, data)
+	if err != nil {
+		return list, err
+	}
+
+	return mapping.Apply(list, options)
+}
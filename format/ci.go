@@ -0,0 +1,97 @@
+package format
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/markeissler/injector/pkg/jsonutil"
+)
+
+// EnvVarGitHubEnv is the environment variable set by GitHub Actions to the path of the file used to set environment
+// variables for subsequent workflow steps.
+const EnvVarGitHubEnv = "GITHUB_ENV"
+
+// WriteGitHubActions writes the flattened list of key/value pairs in the format expected by the GitHub Actions
+// environment file to envWriter, and writes an `::add-mask::` workflow command for each value to maskWriter so that
+// values are redacted from workflow logs. Multiline values are written using the heredoc delimiter syntax and each of
+// their lines is masked separately. Variables to be unset are omitted.
+//
+// See: https://docs.github.com/en/actions/using-workflows/workflow-commands-for-github-actions
+func WriteGitHubActions(envWriter, maskWriter io.Writer, list []jsonutil.KeyValue) error {
+	var envBuf, maskBuf bytes.Buffer
+
+	for _, kv := range withoutUnset(list) {
+		for _, line := range strings.Split(kv.Value, "\n") {
+			if strings.TrimSpace(line) == "" {
+				continue
+			}
+			fmt.Fprintf(&maskBuf, "::add-mask::%s\n", escapeWorkflowCommand(line))
+		}
+
+		if !strings.ContainsAny(kv.Value, "\r\n") {
+			fmt.Fprintf(&envBuf, "%s=%s\n", kv.Key, kv.Value)
+			continue
+		}
+
+		delimiter, err := heredocDelimiter(kv.Value)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(&envBuf, "%s<<%s\n%s\n%s\n", kv.Key, delimiter, kv.Value, delimiter)
+	}
+
+	// Masks must be registered before values can appear anywhere in the logs.
+	if _, err := maskWriter.Write(maskBuf.Bytes()); err != nil {
+		return err
+	}
+
+	_, err := envWriter.Write(envBuf.Bytes())
+
+	return err
+}
+
+// WriteGitLabDotenv writes the flattened list of key/value pairs in the format expected by a GitLab CI
+// `artifacts:reports:dotenv` report. GitLab doesn't support multiline values in dotenv reports so an error will be
+// returned if any are found. Variables to be unset are omitted.
+//
+// See: https://docs.gitlab.com/ee/ci/yaml/artifacts_reports.html#artifactsreportsdotenv
+func WriteGitLabDotenv(writer io.Writer, list []jsonutil.KeyValue) error {
+	var buf bytes.Buffer
+
+	for _, kv := range withoutUnset(list) {
+		if strings.ContainsAny(kv.Value, "\r\n") {
+			return fmt.Errorf("multiline values are not supported in dotenv reports: %s", kv.Key)
+		}
+		fmt.Fprintf(&buf, "%s=%s\n", kv.Key, kv.Value)
+	}
+
+	_, err := writer.Write(buf.Bytes())
+
+	return err
+}
+
+// escapeWorkflowCommand escapes data written as part of a workflow command.
+func escapeWorkflowCommand(s string) string {
+	r := strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A")
+
+	return r.Replace(s)
+}
+
+// heredocDelimiter returns a random delimiter that doesn't appear in the value.
+func heredocDelimiter(value string) (string, error) {
+	for {
+		b := make([]byte, 16)
+		if _, err := rand.Read(b); err != nil {
+			return "", err
+		}
+
+		delimiter := "ghadelimiter_" + hex.EncodeToString(b)
+		if !strings.Contains(value, delimiter) {
+			return delimiter, nil
+		}
+	}
+}
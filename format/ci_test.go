@@ -0,0 +1,42 @@
+package format_test
+
+import (
+	"bytes"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/markeissler/injector/format"
+	"github.com/markeissler/injector/pkg/jsonutil"
+)
+
+func TestFormat_WriteGitHubActions(t *testing.T) {
+	list := []jsonutil.KeyValue{
+		{Key: "APP_DEBUG", Value: "0"},
+		{Key: "TLS_KEY", Value: "-----BEGIN KEY-----\n100%\n-----END KEY-----"},
+		{Key: "EMPTY", Value: ""},
+	}
+
+	var env, mask bytes.Buffer
+	require.NoError(t, format.WriteGitHubActions(&env, &mask, list))
+
+	assert.Equal(t, "::add-mask::0\n::add-mask::-----BEGIN KEY-----\n::add-mask::100%25\n::add-mask::-----END KEY-----\n",
+		mask.String())
+
+	r := regexp.MustCompile(`(?s)^APP_DEBUG=0\nTLS_KEY<<(ghadelimiter_[0-9a-f]+)\n-----BEGIN KEY-----\n100%\n-----END KEY-----\n` +
+		`(ghadelimiter_[0-9a-f]+)\nEMPTY=\n$`)
+	matches := r.FindStringSubmatch(env.String())
+	require.Len(t, matches, 3, env.String())
+	assert.Equal(t, matches[1], matches[2])
+}
+
+func TestFormat_WriteGitLabDotenv(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, format.WriteGitLabDotenv(&buf, []jsonutil.KeyValue{{Key: "APP_DEBUG", Value: "0"}}))
+	assert.Equal(t, "APP_DEBUG=0\n", buf.String())
+
+	buf.Reset()
+	assert.Error(t, format.WriteGitLabDotenv(&buf, []jsonutil.KeyValue{{Key: "TLS_KEY", Value: "a\nb"}}))
+}
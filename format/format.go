@@ -0,0 +1,229 @@
+package format
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/hjson/hjson-go/v4"
+
+	"github.com/markeissler/injector/pkg/jsonutil"
+)
+
+// Format identifies one of the supported output formats.
+type Format string
+
+const (
+	// None indicates that no output format has been selected, in which case contents are injected into the command.
+	None Format = ""
+	// Raw outputs the secret document as returned by the secret manager.
+	Raw Format = "raw"
+	// JSON outputs the secret document as standard JSON.
+	JSON Format = "json"
+	// Shell outputs the secret document as exported shell key/value settings.
+	Shell Format = "shell"
+	// ShellUnexported outputs the secret document as unexported shell key/value settings.
+	ShellUnexported Format = "shell-unexported"
+	// YAML outputs the secret document as YAML (e.g. Helm values).
+	YAML Format = "yaml"
+	// TOML outputs the secret document as TOML.
+	TOML Format = "toml"
+	// Properties outputs the secret document as Java properties.
+	Properties Format = "properties"
+	// SystemdEnvFile outputs the secret document as a systemd `EnvironmentFile`.
+	SystemdEnvFile Format = "systemd-envfile"
+	// GitHubActions outputs the secret document to the GitHub Actions environment file with value masking.
+	GitHubActions Format = "github-actions"
+	// GitLabDotenv outputs the secret document as a GitLab CI dotenv report.
+	GitLabDotenv Format = "gitlab-dotenv"
+)
+
+// formats lists all supported formats in the order they should be presented to users.
+var formats = []Format{
+	Raw, JSON, Shell, ShellUnexported, YAML, TOML, Properties, SystemdEnvFile, GitHubActions, GitLabDotenv,
+}
+
+// Names returns the names of all supported formats.
+func Names() []string {
+	names := make([]string, 0, len(formats))
+	for _, f := range formats {
+		names = append(names, string(f))
+	}
+
+	return names
+}
+
+// Parse returns the Format identified by name. A blank name resolves to None.
+func Parse(name string) (Format, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		return None, nil
+	}
+
+	for _, f := range formats {
+		if string(f) == name {
+			return f, nil
+		}
+	}
+
+	return None, fmt.Errorf("unsupported output format: %s", name)
+}
+
+// IsStructured returns true if the format can represent both the nested document and the flattened key list.
+func (f Format) IsStructured() bool {
+	switch f {
+	case JSON, YAML, TOML, Properties:
+		return true
+	}
+
+	return false
+}
+
+// IsFlat returns true if the format can only represent the flattened key list.
+func (f Format) IsFlat() bool {
+	switch f {
+	case Shell, ShellUnexported, SystemdEnvFile, GitHubActions, GitLabDotenv:
+		return true
+	}
+
+	return false
+}
+
+// WriteDocument writes the nested document data, formatted as specified, to the io.Writer. Only YAML, TOML and
+// Properties formats are supported.
+func WriteDocument(writer io.Writer, f Format, data *hjson.OrderedMap) error {
+	var buf bytes.Buffer
+
+	switch f {
+	case YAML:
+		for _, line := range yamlLines(data) {
+			fmt.Fprintf(&buf, "%s\n", line)
+		}
+	case TOML:
+		writeTOMLTable(&buf, nil, data)
+	case Properties:
+		writePropertiesValue(&buf, "", data)
+	default:
+		return fmt.Errorf("unsupported document format: %s", f)
+	}
+
+	_, err := writer.Write(buf.Bytes())
+
+	return err
+}
+
+// WriteKeyValues writes the flattened list of key/value pairs, formatted as specified, to the io.Writer. Only JSON,
+// YAML, TOML, Properties, SystemdEnvFile and GitLabDotenv formats are supported; use WriteShell for shell formats and
+// WriteGitHubActions for the GitHubActions format. None of these formats can express unsetting a variable so variables
+// to be unset are omitted.
+func WriteKeyValues(writer io.Writer, f Format, list []jsonutil.KeyValue) error {
+	var buf bytes.Buffer
+
+	list = withoutUnset(list)
+
+	switch f {
+	case JSON:
+		writeJSONKeyValues(&buf, list)
+	case YAML:
+		for _, kv := range list {
+			fmt.Fprintf(&buf, "%s: %s\n", yamlKey(kv.Key), quote(kv.Value))
+		}
+	case TOML:
+		for _, kv := range list {
+			fmt.Fprintf(&buf, "%s = %s\n", tomlKey(kv.Key), quote(kv.Value))
+		}
+	case Properties:
+		for _, kv := range list {
+			fmt.Fprintf(&buf, "%s=%s\n", escapeProperty(kv.Key, true), escapeProperty(kv.Value, false))
+		}
+	case SystemdEnvFile:
+		for _, kv := range list {
+			fmt.Fprintf(&buf, "%s=%s\n", kv.Key, quoteSystemd(kv.Value))
+		}
+	case GitLabDotenv:
+		return WriteGitLabDotenv(writer, list)
+	default:
+		return fmt.Errorf("unsupported key/value format: %s", f)
+	}
+
+	_, err := writer.Write(buf.Bytes())
+
+	return err
+}
+
+// withoutUnset returns the list without variables to be unset.
+func withoutUnset(list []jsonutil.KeyValue) []jsonutil.KeyValue {
+	s := make([]jsonutil.KeyValue, 0, len(list))
+	for _, kv := range list {
+		if !kv.Unset {
+			s = append(s, kv)
+		}
+	}
+
+	return s
+}
+
+// writeJSONKeyValues writes the flattened list as a JSON object, preserving the order of the list.
+func writeJSONKeyValues(buf *bytes.Buffer, list []jsonutil.KeyValue) {
+	if len(list) == 0 {
+		buf.WriteString("{}\n")
+		return
+	}
+
+	buf.WriteString("{\n")
+	for i, kv := range list {
+		fmt.Fprintf(buf, "    %s: %s", quote(kv.Key), quote(kv.Value))
+		if i < len(list)-1 {
+			buf.WriteString(",")
+		}
+		buf.WriteString("\n")
+	}
+	buf.WriteString("}\n")
+}
+
+// quote returns s as a double-quoted string using JSON escape sequences. The result is also a valid YAML double-quoted
+// scalar and a valid TOML basic string.
+func quote(s string) string {
+	var buf bytes.Buffer
+
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	_ = encoder.Encode(s)
+
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+// quoteSystemd returns s in double quotes following the rules systemd applies when reading an `EnvironmentFile`.
+// Inside of double quotes systemd recognizes backslash escapes for the backslash, double quote, dollar sign and
+// backtick characters (the same characters escaped for bourne compatible shells); newlines are preserved literally.
+func quoteSystemd(s string) string {
+	return quotePosix(s)
+}
+
+// scalar returns the JSON representation of a scalar value (string, number, bool or nil).
+func scalar(value interface{}) string {
+	if s, ok := value.(string); ok {
+		return quote(s)
+	}
+
+	b, err := json.Marshal(value)
+	if err != nil {
+		return quote(fmt.Sprintf("%v", value))
+	}
+
+	return string(b)
+}
+
+// isContainer returns true if the value is a non-empty object or array.
+func isContainer(value interface{}) bool {
+	switch v := value.(type) {
+	case *hjson.OrderedMap:
+		return v.Len() > 0
+	case []interface{}:
+		return len(v) > 0
+	}
+
+	return false
+}
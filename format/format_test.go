@@ -0,0 +1,117 @@
+package format_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/hjson/hjson-go/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/markeissler/injector/format"
+	"github.com/markeissler/injector/pkg/jsonutil"
+)
+
+func testDocument(t *testing.T) *hjson.OrderedMap {
+	data, err := jsonutil.Parse([]byte(`{
+		environment: {
+			path: /usr/bin:/bin
+			app: {
+				name: "test \"app\""
+				debug: "0"
+			}
+			hosts: ["a", "b"]
+			port: 8080
+			on: true
+		}
+	}`))
+	require.NoError(t, err)
+
+	return data
+}
+
+func TestFormat_Parse(t *testing.T) {
+	f, err := format.Parse("YAML")
+	require.NoError(t, err)
+	assert.Equal(t, format.YAML, f)
+
+	f, err = format.Parse("")
+	require.NoError(t, err)
+	assert.Equal(t, format.None, f)
+
+	_, err = format.Parse("xml")
+	assert.Error(t, err)
+}
+
+func TestFormat_WriteDocument_YAML(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, format.WriteDocument(&buf, format.YAML, testDocument(t)))
+
+	expected := `environment:
+  path: "/usr/bin:/bin"
+  app:
+    name: "test \"app\""
+    debug: "0"
+  hosts:
+    - "a"
+    - "b"
+  port: 8080
+  "on": true
+`
+	assert.Equal(t, expected, buf.String())
+}
+
+func TestFormat_WriteDocument_TOML(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, format.WriteDocument(&buf, format.TOML, testDocument(t)))
+
+	expected := `[environment]
+path = "/usr/bin:/bin"
+hosts = ["a", "b"]
+port = 8080
+on = true
+
+[environment.app]
+name = "test \"app\""
+debug = "0"
+`
+	assert.Equal(t, expected, buf.String())
+}
+
+func TestFormat_WriteDocument_Properties(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, format.WriteDocument(&buf, format.Properties, testDocument(t)))
+
+	expected := `environment.path=/usr/bin\:/bin
+environment.app.name=test "app"
+environment.app.debug=0
+environment.hosts[0]=a
+environment.hosts[1]=b
+environment.port=8080
+environment.on=true
+`
+	assert.Equal(t, expected, buf.String())
+}
+
+func TestFormat_WriteKeyValues(t *testing.T) {
+	list := []jsonutil.KeyValue{
+		{Key: "APP_DEBUG", Value: "0"},
+		{Key: "GREETING", Value: "héllo\nworld"},
+	}
+
+	tests := []struct {
+		format   format.Format
+		expected string
+	}{
+		{format.JSON, "{\n    \"APP_DEBUG\": \"0\",\n    \"GREETING\": \"héllo\\nworld\"\n}\n"},
+		{format.YAML, "APP_DEBUG: \"0\"\nGREETING: \"héllo\\nworld\"\n"},
+		{format.TOML, "APP_DEBUG = \"0\"\nGREETING = \"héllo\\nworld\"\n"},
+		{format.Properties, "APP_DEBUG=0\nGREETING=h\\u00E9llo\\nworld\n"},
+	}
+
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		require.NoError(t, format.WriteKeyValues(&buf, tt.format, list))
+		assert.Equal(t, tt.expected, buf.String(), string(tt.format))
+	}
+}
@@ -0,0 +1,78 @@
+package format
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+
+	"github.com/hjson/hjson-go/v4"
+)
+
+// writePropertiesValue writes the value as Java properties. Object keys are joined with periods and array elements
+// are addressed by index using brackets (e.g. `hosts[0]`), matching the convention used by Spring. Null values are
+// written as empty values.
+func writePropertiesValue(buf *bytes.Buffer, key string, value interface{}) {
+	switch v := value.(type) {
+	case *hjson.OrderedMap:
+		for _, k := range v.Keys {
+			childKey := k
+			if key != "" {
+				childKey = key + "." + k
+			}
+			writePropertiesValue(buf, childKey, v.Map[k])
+		}
+	case []interface{}:
+		for i, item := range v {
+			writePropertiesValue(buf, fmt.Sprintf("%s[%d]", key, i), item)
+		}
+	case nil:
+		fmt.Fprintf(buf, "%s=\n", escapeProperty(key, true))
+	case string:
+		fmt.Fprintf(buf, "%s=%s\n", escapeProperty(key, true), escapeProperty(v, false))
+	default:
+		fmt.Fprintf(buf, "%s=%s\n", escapeProperty(key, true), escapeProperty(scalar(v), false))
+	}
+}
+
+// escapeProperty escapes a key or value following the rules used by java.util.Properties.store(). Characters outside
+// of printable ASCII are written as unicode escapes since properties files are read as ISO 8859-1 by default.
+func escapeProperty(s string, isKey bool) string {
+	var b strings.Builder
+
+	for i, r := range s {
+		switch r {
+		case '\\':
+			b.WriteString(`\\`)
+		case '\t':
+			b.WriteString(`\t`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\f':
+			b.WriteString(`\f`)
+		case '=', ':', '#', '!':
+			b.WriteRune('\\')
+			b.WriteRune(r)
+		case ' ':
+			if isKey || i == 0 {
+				b.WriteRune('\\')
+			}
+			b.WriteRune(r)
+		default:
+			if r < 0x20 || r > 0x7e {
+				if r1, r2 := utf16.EncodeRune(r); r1 != unicode.ReplacementChar {
+					fmt.Fprintf(&b, `\u%04X\u%04X`, r1, r2)
+				} else {
+					fmt.Fprintf(&b, `\u%04X`, r)
+				}
+				continue
+			}
+			b.WriteRune(r)
+		}
+	}
+
+	return b.String()
+}
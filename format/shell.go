@@ -0,0 +1,209 @@
+package format
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/markeissler/injector/pkg/jsonutil"
+)
+
+// Dialect identifies the shell for which shell output formats are written.
+type Dialect string
+
+const (
+	// Posix identifies bourne compatible shells (sh, bash, zsh, ksh).
+	Posix Dialect = "bash"
+	// Fish identifies the fish shell.
+	Fish Dialect = "fish"
+	// Csh identifies the C shell and compatible shells (csh, tcsh).
+	Csh Dialect = "csh"
+	// PowerShell identifies Windows PowerShell and PowerShell Core.
+	PowerShell Dialect = "powershell"
+	// Nushell identifies nushell.
+	Nushell Dialect = "nushell"
+)
+
+// dialects maps recognized shell names to their dialect.
+var dialects = map[string]Dialect{
+	"bash":       Posix,
+	"sh":         Posix,
+	"zsh":        Posix,
+	"ksh":        Posix,
+	"fish":       Fish,
+	"csh":        Csh,
+	"tcsh":       Csh,
+	"powershell": PowerShell,
+	"pwsh":       PowerShell,
+	"nushell":    Nushell,
+	"nu":         Nushell,
+}
+
+// ShellNames returns the names of all recognized shells.
+func ShellNames() []string {
+	names := make([]string, 0, len(dialects))
+	for name := range dialects {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// ParseShell returns the Dialect identified by the shell name. A blank name resolves to Posix.
+func ParseShell(name string) (Dialect, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		return Posix, nil
+	}
+
+	if d, ok := dialects[name]; ok {
+		return d, nil
+	}
+
+	return Posix, fmt.Errorf("unsupported shell: %s", name)
+}
+
+// WriteShell writes the flattened list of key/value pairs as shell variable assignments for the given dialect to the
+// io.Writer. When exported is true the variables will be exported to the environment of child processes, otherwise
+// they will be set as shell (local) variables. Variables to be unset are written as commands that unset them.
+func WriteShell(writer io.Writer, dialect Dialect, exported bool, list []jsonutil.KeyValue) error {
+	var buf bytes.Buffer
+
+	for _, kv := range list {
+		if kv.Unset {
+			writeShellUnset(&buf, dialect, exported, kv.Key)
+			continue
+		}
+
+		switch dialect {
+		case Posix:
+			if exported {
+				buf.WriteString("export ")
+			}
+			fmt.Fprintf(&buf, "%s=%s\n", kv.Key, quotePosix(kv.Value))
+		case Fish:
+			scope := "-g"
+			if exported {
+				scope = "-gx"
+			}
+			fmt.Fprintf(&buf, "set %s %s %s\n", scope, kv.Key, quoteFish(kv.Value))
+		case Csh:
+			if exported {
+				fmt.Fprintf(&buf, "setenv %s %s\n", kv.Key, quoteCsh(kv.Value))
+			} else {
+				fmt.Fprintf(&buf, "set %s = %s\n", kv.Key, quoteCsh(kv.Value))
+			}
+		case PowerShell:
+			scope := "$"
+			if exported {
+				scope = "$env:"
+			}
+			fmt.Fprintf(&buf, "%s%s = %s\n", scope, kv.Key, quotePowerShell(kv.Value))
+		case Nushell:
+			if exported {
+				fmt.Fprintf(&buf, "$env.%s = %s\n", kv.Key, quoteNushell(kv.Value))
+			} else {
+				fmt.Fprintf(&buf, "let %s = %s\n", kv.Key, quoteNushell(kv.Value))
+			}
+		default:
+			return fmt.Errorf("unsupported shell: %s", dialect)
+		}
+	}
+
+	_, err := writer.Write(buf.Bytes())
+
+	return err
+}
+
+// writeShellUnset writes the command that unsets the named variable for the given dialect. Nushell can't unset a
+// variable declared with `let` so nothing is written for unexported nushell variables.
+func writeShellUnset(buf *bytes.Buffer, dialect Dialect, exported bool, key string) {
+	switch dialect {
+	case Posix:
+		fmt.Fprintf(buf, "unset %s\n", key)
+	case Fish:
+		fmt.Fprintf(buf, "set -e %s\n", key)
+	case Csh:
+		if exported {
+			fmt.Fprintf(buf, "unsetenv %s\n", key)
+		} else {
+			fmt.Fprintf(buf, "unset %s\n", key)
+		}
+	case PowerShell:
+		if exported {
+			fmt.Fprintf(buf, "Remove-Item Env:%s -ErrorAction SilentlyContinue\n", key)
+		} else {
+			fmt.Fprintf(buf, "Remove-Variable %s -ErrorAction SilentlyContinue\n", key)
+		}
+	case Nushell:
+		if exported {
+			fmt.Fprintf(buf, "hide-env --ignore-errors %s\n", key)
+		}
+	}
+}
+
+// quotePosix returns s in double quotes, escaping the characters that remain special inside of double quotes for
+// bourne compatible shells.
+func quotePosix(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, `$`, `\$`, "`", "\\`")
+
+	return `"` + r.Replace(s) + `"`
+}
+
+// quoteFish returns s in single quotes. Inside of single quotes fish only recognizes the escapes `\'` and `\\`.
+func quoteFish(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `'`, `\'`)
+
+	return `'` + r.Replace(s) + `'`
+}
+
+// quoteCsh returns s in single quotes. Single quotes can't be escaped inside of a single quoted string so the string
+// is closed, an escaped quote is inserted and the string is reopened. History substitution (`!`) and newlines must be
+// escaped with a backslash even inside of single quotes.
+func quoteCsh(s string) string {
+	r := strings.NewReplacer(`'`, `'\''`, `!`, `\!`, "\n", "\\\n")
+
+	return `'` + r.Replace(s) + `'`
+}
+
+// quotePowerShell returns s in single quotes (a verbatim string). Single quotes are escaped by doubling them,
+// including the typographic single quotes (U+2018 to U+201B) that PowerShell also accepts as delimiters.
+func quotePowerShell(s string) string {
+	r := strings.NewReplacer(`'`, `''`, "\u2018", "\u2018\u2018", "\u2019", "\u2019\u2019", "\u201a", "\u201a\u201a",
+		"\u201b", "\u201b\u201b")
+
+	return `'` + r.Replace(s) + `'`
+}
+
+// quoteNushell returns s in double quotes, escaping backslashes, double quotes and control characters.
+func quoteNushell(s string) string {
+	var b strings.Builder
+
+	b.WriteRune('"')
+	for _, r := range s {
+		switch r {
+		case '\\':
+			b.WriteString(`\\`)
+		case '"':
+			b.WriteString(`\"`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		default:
+			if r < 0x20 {
+				fmt.Fprintf(&b, `\u{%x}`, r)
+				continue
+			}
+			b.WriteRune(r)
+		}
+	}
+	b.WriteRune('"')
+
+	return b.String()
+}
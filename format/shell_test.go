@@ -0,0 +1,86 @@
+package format_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/markeissler/injector/format"
+	"github.com/markeissler/injector/pkg/jsonutil"
+)
+
+func TestFormat_ParseShell(t *testing.T) {
+	d, err := format.ParseShell("tcsh")
+	require.NoError(t, err)
+	assert.Equal(t, format.Csh, d)
+
+	d, err = format.ParseShell("")
+	require.NoError(t, err)
+	assert.Equal(t, format.Posix, d)
+
+	_, err = format.ParseShell("cmd.exe")
+	assert.Error(t, err)
+}
+
+func TestFormat_WriteShell(t *testing.T) {
+	list := []jsonutil.KeyValue{
+		{Key: "GREETING", Value: `it's "$HOME"!`},
+	}
+
+	tests := []struct {
+		dialect    format.Dialect
+		exported   string
+		unexported string
+	}{
+		{format.Posix, `export GREETING="it's \"\$HOME\"!"`, `GREETING="it's \"\$HOME\"!"`},
+		{format.Fish, `set -gx GREETING 'it\'s "$HOME"!'`, `set -g GREETING 'it\'s "$HOME"!'`},
+		{format.Csh, `setenv GREETING 'it'\''s "$HOME"\!'`, `set GREETING = 'it'\''s "$HOME"\!'`},
+		{format.PowerShell, `$env:GREETING = 'it''s "$HOME"!'`, `$GREETING = 'it''s "$HOME"!'`},
+		{format.Nushell, `$env.GREETING = "it's \"$HOME\"!"`, `let GREETING = "it's \"$HOME\"!"`},
+	}
+
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		require.NoError(t, format.WriteShell(&buf, tt.dialect, true, list))
+		assert.Equal(t, tt.exported+"\n", buf.String(), string(tt.dialect))
+
+		buf.Reset()
+		require.NoError(t, format.WriteShell(&buf, tt.dialect, false, list))
+		assert.Equal(t, tt.unexported+"\n", buf.String(), string(tt.dialect))
+	}
+}
+
+func TestFormat_WriteShell_PowerShellQuotes(t *testing.T) {
+	list := []jsonutil.KeyValue{{Key: "GREETING", Value: "\u2018a\u2019 \u201ab\u201b; Remove-Item x"}}
+
+	var buf bytes.Buffer
+	require.NoError(t, format.WriteShell(&buf, format.PowerShell, true, list))
+	assert.Equal(t, "$env:GREETING = '\u2018\u2018a\u2019\u2019 \u201a\u201ab\u201b\u201b; Remove-Item x'\n", buf.String())
+}
+
+func TestFormat_WriteShell_Unset(t *testing.T) {
+	list := []jsonutil.KeyValue{{Key: "PROXY", Unset: true}}
+
+	tests := []struct {
+		dialect  format.Dialect
+		expected string
+	}{
+		{format.Posix, "unset PROXY\n"},
+		{format.Fish, "set -e PROXY\n"},
+		{format.Csh, "unsetenv PROXY\n"},
+		{format.PowerShell, "Remove-Item Env:PROXY -ErrorAction SilentlyContinue\n"},
+		{format.Nushell, "hide-env --ignore-errors PROXY\n"},
+	}
+
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		require.NoError(t, format.WriteShell(&buf, tt.dialect, true, list))
+		assert.Equal(t, tt.expected, buf.String(), string(tt.dialect))
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, format.WriteKeyValues(&buf, format.YAML, list))
+	assert.Empty(t, buf.String())
+}
@@ -0,0 +1,133 @@
+package format
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/hjson/hjson-go/v4"
+)
+
+// tomlBareKey matches keys that can be written without quotes.
+var tomlBareKey = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// tomlKey returns the key quoted if it can't be written as a bare TOML key.
+func tomlKey(key string) string {
+	if tomlBareKey.MatchString(key) {
+		return key
+	}
+
+	return quote(key)
+}
+
+// tomlPath returns the dotted TOML representation of a table path.
+func tomlPath(path []string) string {
+	keys := make([]string, 0, len(path))
+	for _, k := range path {
+		keys = append(keys, tomlKey(k))
+	}
+
+	return strings.Join(keys, ".")
+}
+
+// isTableArray returns true if the value is a non-empty array containing only objects.
+func isTableArray(value interface{}) bool {
+	list, ok := value.([]interface{})
+	if !ok || len(list) == 0 {
+		return false
+	}
+	for _, item := range list {
+		if _, ok := item.(*hjson.OrderedMap); !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+// writeTOMLTable writes the object as a TOML table. Key/value pairs are written first followed by sub-tables and
+// arrays of tables since TOML assigns keys to the most recently declared table. The table header is only written when
+// the table has key/value pairs of its own or is empty; TOML declares parent tables implicitly. TOML has no concept of
+// null so null values are omitted.
+func writeTOMLTable(buf *bytes.Buffer, path []string, data *hjson.OrderedMap) {
+	values := make([]string, 0)
+	for _, k := range data.Keys {
+		switch data.Map[k].(type) {
+		case nil:
+			continue
+		case *hjson.OrderedMap:
+			continue
+		}
+		if isTableArray(data.Map[k]) {
+			continue
+		}
+		values = append(values, fmt.Sprintf("%s = %s", tomlKey(k), tomlInline(data.Map[k])))
+	}
+
+	if len(path) > 0 && (len(values) > 0 || data.Len() == 0) {
+		if buf.Len() > 0 {
+			buf.WriteString("\n")
+		}
+		fmt.Fprintf(buf, "[%s]\n", tomlPath(path))
+	}
+	for _, v := range values {
+		fmt.Fprintf(buf, "%s\n", v)
+	}
+
+	for _, k := range data.Keys {
+		childPath := append(append([]string{}, path...), k)
+		if m, ok := data.Map[k].(*hjson.OrderedMap); ok {
+			writeTOMLTable(buf, childPath, m)
+			continue
+		}
+		if isTableArray(data.Map[k]) {
+			for _, item := range data.Map[k].([]interface{}) {
+				if buf.Len() > 0 {
+					buf.WriteString("\n")
+				}
+				fmt.Fprintf(buf, "[[%s]]\n", tomlPath(childPath))
+				writeTOMLArrayTable(buf, item.(*hjson.OrderedMap))
+			}
+		}
+	}
+}
+
+// writeTOMLArrayTable writes the contents of a single array of tables entry whose header has already been written.
+func writeTOMLArrayTable(buf *bytes.Buffer, data *hjson.OrderedMap) {
+	for _, k := range data.Keys {
+		if data.Map[k] == nil {
+			continue
+		}
+		fmt.Fprintf(buf, "%s = %s\n", tomlKey(k), tomlInline(data.Map[k]))
+	}
+}
+
+// tomlInline returns the inline TOML representation of a value.
+func tomlInline(value interface{}) string {
+	switch v := value.(type) {
+	case *hjson.OrderedMap:
+		pairs := make([]string, 0, v.Len())
+		for _, k := range v.Keys {
+			if v.Map[k] == nil {
+				continue
+			}
+			pairs = append(pairs, fmt.Sprintf("%s = %s", tomlKey(k), tomlInline(v.Map[k])))
+		}
+		if len(pairs) == 0 {
+			return "{}"
+		}
+		return "{ " + strings.Join(pairs, ", ") + " }"
+	case []interface{}:
+		items := make([]string, 0, len(v))
+		for _, item := range v {
+			if item == nil {
+				continue
+			}
+			items = append(items, tomlInline(item))
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	}
+
+	return scalar(value)
+}
@@ -0,0 +1,75 @@
+package format
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/hjson/hjson-go/v4"
+)
+
+// yamlPlainKey matches keys that can be written without quotes.
+var yamlPlainKey = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.-]*$`)
+
+// yamlReservedKeys lists plain scalars that YAML parsers may resolve to non-string values.
+var yamlReservedKeys = map[string]bool{
+	"y": true, "yes": true, "n": true, "no": true, "true": true, "false": true,
+	"on": true, "off": true, "null": true,
+}
+
+// yamlKey returns the key quoted if it can't be written as a plain YAML scalar.
+func yamlKey(key string) string {
+	if yamlPlainKey.MatchString(key) && !yamlReservedKeys[strings.ToLower(key)] {
+		return key
+	}
+
+	return quote(key)
+}
+
+// yamlEmpty returns the flow representation of empty containers and scalars.
+func yamlEmpty(value interface{}) string {
+	switch value.(type) {
+	case *hjson.OrderedMap:
+		return "{}"
+	case []interface{}:
+		return "[]"
+	}
+
+	return scalar(value)
+}
+
+// yamlLines renders an object or array as block YAML, returning one string per line without trailing newlines.
+func yamlLines(value interface{}) []string {
+	lines := make([]string, 0)
+
+	switch v := value.(type) {
+	case *hjson.OrderedMap:
+		for _, k := range v.Keys {
+			if !isContainer(v.Map[k]) {
+				lines = append(lines, yamlKey(k)+": "+yamlEmpty(v.Map[k]))
+				continue
+			}
+			lines = append(lines, yamlKey(k)+":")
+			for _, line := range yamlLines(v.Map[k]) {
+				lines = append(lines, "  "+line)
+			}
+		}
+	case []interface{}:
+		for _, item := range v {
+			if !isContainer(item) {
+				lines = append(lines, "- "+yamlEmpty(item))
+				continue
+			}
+			for i, line := range yamlLines(item) {
+				if i == 0 {
+					lines = append(lines, "- "+line)
+				} else {
+					lines = append(lines, "  "+line)
+				}
+			}
+		}
+	default:
+		lines = append(lines, yamlEmpty(v))
+	}
+
+	return lines
+}
@@ -0,0 +1,335 @@
+package gcp
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/hjson/hjson-go/v4"
+
+	"github.com/markeissler/injector/pkg/jsonutil"
+	"github.com/markeissler/injector/pkg/stringutil"
+)
+
+// ReferencePrefix identifies document values that reference a value stored in another secret manager document. A
+// reference has the form `ref+gcpsm://PROJECT/SECRET[@VERSION][#PATH]` where PATH (see jsonutil.Get) selects a value
+// from the referenced document; the entire referenced document is used as a string value if no PATH is specified.
+const ReferencePrefix = "ref+gcpsm://"
+
+// FetchFunc retrieves the secret manager document identified by the request and writes the contents to the specified
+// io.Writer (see FetchSecret).
+type FetchFunc func(ctx context.Context, secret SecretRequest, writer io.Writer) error
+
+// MaxIncludeDepth is the maximum depth of nested include directives.
+const MaxIncludeDepth = 8
+
+// Resolver resolves include directives and cross-secret references within parsed documents. Each secret is fetched
+// once per resolver, no matter how many times it's included or referenced.
+type Resolver struct {
+	// KeyFile is the path to a file containing a JSON format service account key used to fetch referenced secrets.
+	KeyFile string
+	// KeyValue is a base64 encoded string containing a JSON format service account key used to fetch referenced
+	// secrets.
+	KeyValue string
+	// Fetch retrieves referenced secrets. FetchSecret is used if not specified.
+	Fetch FetchFunc
+	// Prepare, if specified, transforms each included document after it has been parsed and before its own include
+	// directive is resolved (e.g. to apply conditional blocks).
+	Prepare func(data *hjson.OrderedMap) (*hjson.OrderedMap, error)
+
+	payloads  map[string][]byte
+	documents map[string]*hjson.OrderedMap
+}
+
+// reference is a parsed cross-secret reference.
+type reference struct {
+	request SecretRequest
+	path    string
+}
+
+// secretID returns the identity of a secret version, used for caching and cycle detection.
+func secretID(secret SecretRequest) string {
+	version := secret.Version
+	if stringutil.IsBlank(version) {
+		version = "latest"
+	}
+
+	return fmt.Sprintf("%s/%s@%s", secret.Project, secret.Name, version)
+}
+
+// parseReference returns the reference described by value. The second return value is false if value isn't a
+// reference.
+func parseReference(value string) (reference, bool, error) {
+	if !strings.HasPrefix(value, ReferencePrefix) {
+		return reference{}, false, nil
+	}
+
+	var ref reference
+	location := strings.TrimPrefix(value, ReferencePrefix)
+	if i := strings.Index(location, "#"); i >= 0 {
+		location, ref.path = location[:i], location[i+1:]
+	}
+	if i := strings.LastIndex(location, "@"); i >= 0 {
+		location, ref.request.Version = location[:i], location[i+1:]
+	}
+
+	parts := strings.Split(location, "/")
+	if len(parts) != 2 || stringutil.IsBlank(parts[0]) || stringutil.IsBlank(parts[1]) {
+		return reference{}, true, fmt.Errorf("invalid secret reference: %s", value)
+	}
+	ref.request.Project, ref.request.Name = parts[0], parts[1]
+
+	return ref, true, nil
+}
+
+// IncludeKey is the top-level document property listing the secrets included by the document.
+const IncludeKey = "include"
+
+// IncludeTree describes the secrets included by a document, in order.
+type IncludeTree struct {
+	Secret   string
+	Includes []*IncludeTree
+}
+
+// Write writes the include tree to the io.Writer with one secret per line, indented by depth.
+func (t *IncludeTree) Write(writer io.Writer) error {
+	return t.write(writer, 0)
+}
+
+// write writes the include tree at the specified depth.
+func (t *IncludeTree) write(writer io.Writer, depth int) error {
+	if _, err := fmt.Fprintf(writer, "%s%s\n", strings.Repeat("  ", depth), t.Secret); err != nil {
+		return err
+	}
+	for _, include := range t.Includes {
+		if err := include.write(writer, depth+1); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ParseSecretName returns the request for a secret named relative to the source secret (e.g. an included secret).
+// Names have the form `[PROJECT/]SECRET[@VERSION]`; the project of the source secret is used if no project is
+// specified.
+func ParseSecretName(name string, source SecretRequest) (SecretRequest, error) {
+	request := SecretRequest{Project: source.Project}
+
+	location := strings.TrimSpace(name)
+	if i := strings.LastIndex(location, "@"); i >= 0 {
+		location, request.Version = location[:i], location[i+1:]
+	}
+
+	parts := strings.Split(location, "/")
+	switch {
+	case len(parts) == 1 && !stringutil.IsBlank(parts[0]):
+		request.Name = parts[0]
+	case len(parts) == 2 && !stringutil.IsBlank(parts[0]) && !stringutil.IsBlank(parts[1]):
+		request.Project, request.Name = parts[0], parts[1]
+	default:
+		return request, fmt.Errorf("invalid secret name: %s", name)
+	}
+
+	return request, nil
+}
+
+// includes returns the names listed by the include directive of the document, which may be a string or an array of
+// strings.
+func includes(data *hjson.OrderedMap) ([]string, error) {
+	switch v := data.Map[IncludeKey].(type) {
+	case nil:
+		return []string{}, nil
+	case string:
+		return []string{v}, nil
+	case []interface{}:
+		names := make([]string, 0, len(v))
+		for _, item := range v {
+			name, ok := item.(string)
+			if !ok {
+				return []string{}, fmt.Errorf("include must be a string or an array of strings")
+			}
+			names = append(names, name)
+		}
+		return names, nil
+	}
+
+	return []string{}, fmt.Errorf("include must be a string or an array of strings")
+}
+
+// ResolveIncludes returns the document that results from merging the documents listed by the include directive of the
+// data tree, which was parsed from the source secret, in order and then merging the data tree over them (see
+// jsonutil.Merge). Included documents may include other documents, up to MaxIncludeDepth levels. The include directive
+// is removed from the data tree and from the result. The returned IncludeTree describes the secrets that were included.
+func (r *Resolver) ResolveIncludes(ctx context.Context, source SecretRequest, data *hjson.OrderedMap) (
+	*hjson.OrderedMap, *IncludeTree, error) {
+	return r.resolveIncludes(ctx, []string{secretID(source)}, source, data)
+}
+
+// resolveIncludes resolves the include directive of the data tree. The stack lists the ids of the including secrets,
+// in order.
+func (r *Resolver) resolveIncludes(ctx context.Context, stack []string, source SecretRequest, data *hjson.OrderedMap) (
+	*hjson.OrderedMap, *IncludeTree, error) {
+	tree := &IncludeTree{Secret: stack[len(stack)-1], Includes: []*IncludeTree{}}
+
+	names, err := includes(data)
+	if err != nil {
+		return data, tree, err
+	}
+	data.DeleteKey(IncludeKey)
+	if len(names) == 0 {
+		return data, tree, nil
+	}
+	if len(stack) > MaxIncludeDepth {
+		return data, tree, fmt.Errorf("maximum include depth (%d) exceeded: %s", MaxIncludeDepth, strings.Join(stack, " -> "))
+	}
+
+	merged := hjson.NewOrderedMap()
+	for _, name := range names {
+		var request SecretRequest
+		if request, err = ParseSecretName(name, source); err != nil {
+			return data, tree, fmt.Errorf("invalid include: %s", name)
+		}
+
+		id := secretID(request)
+		for _, s := range stack {
+			if s == id {
+				return data, tree, fmt.Errorf("include cycle: %s -> %s", strings.Join(stack, " -> "), id)
+			}
+		}
+
+		var payload []byte
+		if payload, err = r.payload(ctx, request); err != nil {
+			return data, tree, fmt.Errorf("failed to include %s: %v", id, err)
+		}
+
+		var included *hjson.OrderedMap
+		if included, err = jsonutil.Parse(payload); err != nil {
+			return data, tree, fmt.Errorf("failed to parse included secret %s: %v", id, err)
+		}
+		if r.Prepare != nil {
+			if included, err = r.Prepare(included); err != nil {
+				return data, tree, fmt.Errorf("failed to prepare included secret %s: %v", id, err)
+			}
+		}
+
+		var subtree *IncludeTree
+		if included, subtree, err = r.resolveIncludes(ctx, append(append([]string{}, stack...), id), request, included); err != nil {
+			return data, tree, err
+		}
+		tree.Includes = append(tree.Includes, subtree)
+
+		merged = jsonutil.Merge(merged, included)
+	}
+
+	return jsonutil.Merge(merged, data), tree, nil
+}
+
+// ResolveReferences replaces references within the data tree, which was parsed from the source secret, with the values they
+// reference. References within referenced documents are resolved as well. An error is returned if a reference can't be
+// resolved or if references form a cycle (including a reference to the source secret).
+func (r *Resolver) ResolveReferences(ctx context.Context, source SecretRequest, data *hjson.OrderedMap) error {
+	_, err := r.resolveValue(ctx, []string{secretID(source)}, data)
+
+	return err
+}
+
+// resolveValue returns the value with references resolved. Objects and arrays are updated in place. The stack lists
+// the ids of the secrets being resolved, in order.
+func (r *Resolver) resolveValue(ctx context.Context, stack []string, value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case *hjson.OrderedMap:
+		for _, key := range v.Keys {
+			resolved, err := r.resolveValue(ctx, stack, v.Map[key])
+			if err != nil {
+				return v, err
+			}
+			v.Map[key] = resolved
+		}
+	case []interface{}:
+		for i := range v {
+			resolved, err := r.resolveValue(ctx, stack, v[i])
+			if err != nil {
+				return v, err
+			}
+			v[i] = resolved
+		}
+	case string:
+		ref, ok, err := parseReference(v)
+		if !ok || err != nil {
+			return v, err
+		}
+		return r.resolveReference(ctx, stack, ref, v)
+	}
+
+	return value, nil
+}
+
+// resolveReference returns the value identified by the reference.
+func (r *Resolver) resolveReference(ctx context.Context, stack []string, ref reference, raw string) (interface{}, error) {
+	id := secretID(ref.request)
+	for _, s := range stack {
+		if s == id {
+			return nil, fmt.Errorf("secret reference cycle: %s -> %s", strings.Join(stack, " -> "), id)
+		}
+	}
+
+	payload, err := r.payload(ctx, ref.request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve secret reference %s: %v", raw, err)
+	}
+
+	if stringutil.IsBlank(ref.path) {
+		return string(payload), nil
+	}
+
+	document, ok := r.documents[id]
+	if !ok {
+		if document, err = jsonutil.Parse(payload); err != nil {
+			return nil, fmt.Errorf("failed to parse referenced secret %s: %v", id, err)
+		}
+		if _, err = r.resolveValue(ctx, append(append([]string{}, stack...), id), document); err != nil {
+			return nil, err
+		}
+		r.documents[id] = document
+	}
+
+	value, ok := jsonutil.Get(document, ref.path)
+	if !ok {
+		return nil, fmt.Errorf("secret reference path not found: %s", raw)
+	}
+
+	return value, nil
+}
+
+// payload returns the contents of the secret, fetching it only if it hasn't already been fetched.
+func (r *Resolver) payload(ctx context.Context, secret SecretRequest) ([]byte, error) {
+	if r.payloads == nil {
+		r.payloads = make(map[string][]byte)
+		r.documents = make(map[string]*hjson.OrderedMap)
+	}
+
+	id := secretID(secret)
+	if payload, ok := r.payloads[id]; ok {
+		return payload, nil
+	}
+
+	fetch := r.Fetch
+	if fetch == nil {
+		fetch = FetchSecret
+	}
+
+	var buf bytes.Buffer
+	secret.KeyFile, secret.KeyValue = r.KeyFile, r.KeyValue
+	if err := fetch(ctx, secret, &buf); err != nil {
+		return []byte{}, err
+	}
+
+	// FetchSecret terminates the contents with a newline.
+	payload := bytes.TrimSuffix(buf.Bytes(), []byte("\n"))
+	r.payloads[id] = payload
+
+	return payload, nil
+}
@@ -0,0 +1,210 @@
+package gcp_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/hjson/hjson-go/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/markeissler/injector/gcp"
+	"github.com/markeissler/injector/pkg/jsonutil"
+)
+
+// fakeSecrets returns a FetchFunc serving secrets from a map keyed by `PROJECT/SECRET` and a map counting fetches.
+func fakeSecrets(secrets map[string]string) (gcp.FetchFunc, map[string]int) {
+	fetches := make(map[string]int)
+
+	return func(ctx context.Context, secret gcp.SecretRequest, writer io.Writer) error {
+		key := secret.Project + "/" + secret.Name
+		fetches[key]++
+		payload, ok := secrets[key]
+		if !ok {
+			return errors.New("not found")
+		}
+		_, err := fmt.Fprintf(writer, "%s\n", payload)
+		return err
+	}, fetches
+}
+
+func TestResolver_ResolveReferences(t *testing.T) {
+	fetch, fetches := fakeSecrets(map[string]string{
+		"shared/db-creds": `{ password: "s3cret", port: 5432, nested: { token: "ref+gcpsm://shared/token" } }`,
+		"shared/token":    "abc",
+	})
+
+	data, err := jsonutil.Parse([]byte(`{
+		environment: {
+			db_password: "ref+gcpsm://shared/db-creds#password"
+			db_port: "ref+gcpsm://shared/db-creds#port"
+			api: "ref+gcpsm://shared/db-creds#nested"
+			token: "ref+gcpsm://shared/token"
+		}
+	}`))
+	require.NoError(t, err)
+
+	resolver := gcp.Resolver{Fetch: fetch}
+	require.NoError(t, resolver.ResolveReferences(context.Background(), gcp.SecretRequest{Project: "app", Name: "env"}, data))
+
+	list, err := jsonutil.FlattenKeyValues(data, "environment", jsonutil.Options{})
+	require.NoError(t, err)
+	values := make(map[string]string)
+	for _, kv := range list {
+		values[kv.Key] = kv.Value
+	}
+	assert.Equal(t, map[string]string{
+		"DB_PASSWORD": "s3cret",
+		"DB_PORT":     "5432",
+		"API_TOKEN":   "abc",
+		"TOKEN":       "abc",
+	}, values)
+	assert.Equal(t, map[string]int{"shared/db-creds": 1, "shared/token": 1}, fetches)
+}
+
+func TestResolver_ResolveReferences_Errors(t *testing.T) {
+	fetch, _ := fakeSecrets(map[string]string{
+		"shared/a": `{ value: "ref+gcpsm://shared/b#value" }`,
+		"shared/b": `{ value: "ref+gcpsm://shared/a#value" }`,
+		"shared/c": `{ value: 1 }`,
+	})
+
+	tests := []struct {
+		document string
+		expected string
+	}{
+		{
+			document: `{ a: "ref+gcpsm://shared/a#value" }`,
+			expected: "secret reference cycle: app/env@latest -> shared/a@latest -> shared/b@latest -> shared/a@latest",
+		},
+		{
+			document: `{ a: "ref+gcpsm://app/env#b" }`,
+			expected: "secret reference cycle: app/env@latest -> app/env@latest",
+		},
+		{
+			document: `{ a: "ref+gcpsm://shared/c#missing" }`,
+			expected: "secret reference path not found: ref+gcpsm://shared/c#missing",
+		},
+		{
+			document: `{ a: "ref+gcpsm://shared" }`,
+			expected: "invalid secret reference: ref+gcpsm://shared",
+		},
+		{
+			document: `{ a: "ref+gcpsm://shared/missing@3" }`,
+			expected: "failed to resolve secret reference ref+gcpsm://shared/missing@3: not found",
+		},
+	}
+
+	for _, tt := range tests {
+		data, err := jsonutil.Parse([]byte(tt.document))
+		require.NoError(t, err)
+
+		resolver := gcp.Resolver{Fetch: fetch}
+		err = resolver.ResolveReferences(context.Background(), gcp.SecretRequest{Project: "app", Name: "env"}, data)
+		assert.EqualError(t, err, tt.expected)
+	}
+}
+
+func TestResolver_ResolveIncludes(t *testing.T) {
+	fetch, fetches := fakeSecrets(map[string]string{
+		"app/shared-logging": `{ include: "shared/base", environment: { log_level: "info", log_format: "json" } }`,
+		"shared/shared-otel": `{ include: ["shared/base"], environment: { otel_endpoint: "collector:4317" } }`,
+		"shared/base":        `{ environment: { region: "us-east1", log_level: "warn" } }`,
+	})
+
+	data, err := jsonutil.Parse([]byte(`{
+		include: ["shared-logging", "shared/shared-otel@2"]
+		environment: { log_level: "debug", app: "billing" }
+	}`))
+	require.NoError(t, err)
+
+	resolver := gcp.Resolver{Fetch: fetch}
+	merged, tree, err := resolver.ResolveIncludes(context.Background(), gcp.SecretRequest{Project: "app", Name: "env"}, data)
+	require.NoError(t, err)
+
+	b, err := jsonutil.Marshal(merged)
+	require.NoError(t, err)
+	expected := `{"environment":{"region":"us-east1","log_level":"debug","log_format":"json","otel_endpoint":"collector:4317",` +
+		`"app":"billing"}}`
+	assert.Equal(t, expected, string(b))
+	assert.Equal(t, 1, fetches["shared/base"])
+
+	var buf bytes.Buffer
+	require.NoError(t, tree.Write(&buf))
+	assert.Equal(t, `app/env@latest
+  app/shared-logging@latest
+    shared/base@latest
+  shared/shared-otel@2
+    shared/base@latest
+`, buf.String())
+}
+
+func TestResolver_ResolveIncludes_Errors(t *testing.T) {
+	fetch, _ := fakeSecrets(map[string]string{
+		"app/a": `{ include: "b" }`,
+		"app/b": `{ include: "a" }`,
+		"app/0": `{ include: "1" }`, "app/1": `{ include: "2" }`, "app/2": `{ include: "3" }`,
+		"app/3": `{ include: "4" }`, "app/4": `{ include: "5" }`, "app/5": `{ include: "6" }`,
+		"app/6": `{ include: "7" }`, "app/7": `{ include: "8" }`, "app/8": `{ include: "9" }`,
+		"app/9": `{}`,
+	})
+
+	tests := []struct {
+		document string
+		expected string
+	}{
+		{
+			document: `{ include: "a" }`,
+			expected: "include cycle: app/env@latest -> app/a@latest -> app/b@latest -> app/a@latest",
+		},
+		{
+			document: `{ include: "0" }`,
+			expected: "maximum include depth (8) exceeded: app/env@latest -> app/0@latest -> app/1@latest -> " +
+				"app/2@latest -> app/3@latest -> app/4@latest -> app/5@latest -> app/6@latest -> app/7@latest",
+		},
+		{
+			document: `{ include: [1] }`,
+			expected: "include must be a string or an array of strings",
+		},
+		{
+			document: `{ include: "a/b/c" }`,
+			expected: "invalid include: a/b/c",
+		},
+	}
+
+	for _, tt := range tests {
+		data, err := jsonutil.Parse([]byte(tt.document))
+		require.NoError(t, err)
+
+		resolver := gcp.Resolver{Fetch: fetch}
+		_, _, err = resolver.ResolveIncludes(context.Background(), gcp.SecretRequest{Project: "app", Name: "env"}, data)
+		assert.EqualError(t, err, tt.expected)
+	}
+}
+
+func TestResolver_ResolveIncludes_Prepare(t *testing.T) {
+	fetch, _ := fakeSecrets(map[string]string{
+		"app/base": `{ environment: { a: "base" }, when: [{ if: { env: "prod" }, environment: { a: "prod" } }] }`,
+	})
+
+	data, err := jsonutil.Parse([]byte(`{ include: "base" }`))
+	require.NoError(t, err)
+
+	resolver := gcp.Resolver{
+		Fetch: fetch,
+		Prepare: func(document *hjson.OrderedMap) (*hjson.OrderedMap, error) {
+			selected, _, err := jsonutil.ApplyConditions(document, map[string]string{"env": "prod"})
+			return selected, err
+		},
+	}
+	merged, _, err := resolver.ResolveIncludes(context.Background(), gcp.SecretRequest{Project: "app", Name: "env"}, data)
+	require.NoError(t, err)
+
+	b, err := jsonutil.Marshal(merged)
+	require.NoError(t, err)
+	assert.Equal(t, `{"environment":{"a":"prod"}}`, string(b))
+}
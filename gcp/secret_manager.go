@@ -1,6 +1,7 @@
 package gcp
 
 import (
+	"context"
 	"encoding/base64"
 	"fmt"
 	"io"
@@ -14,19 +15,51 @@ import (
 	"github.com/markeissler/injector/pkg/stringutil"
 )
 
+// SecretRequest identifies a secret manager document and the credentials used to access it. If neither a KeyFile nor a
+// KeyValue is specified then Application Default Credentials will be used.
+type SecretRequest struct {
+	// KeyFile is the path to a file containing a JSON format service account key.
+	KeyFile string
+	// KeyValue is a base64 encoded string containing a JSON format service account key.
+	KeyValue string
+	// Project is the GCP project id.
+	Project string
+	// Name is the name of the secret.
+	Name string
+	// Version is the version of the secret, `latest` if not specified.
+	Version string
+}
+
+// NewSecretRequest returns the SecretRequest for the secret manager document specified in cli arguments.
+func NewSecretRequest(ctx *cli.Context) SecretRequest {
+	return SecretRequest{
+		KeyFile:  ctx.String("key-file"),
+		KeyValue: ctx.String("key-value"),
+		Project:  ctx.String("project"),
+		Name:     ctx.String("secret-name"),
+		Version:  ctx.String("secret-version"),
+	}
+}
+
 // FetchSecretDocument retrieves the secret manager document specified in cli arguments and writes the contents to the
 // specified io.Writer. The `latest` version will be retrieved if no version has been specified.
 func FetchSecretDocument(ctx *cli.Context, writer io.Writer) error {
+	return FetchSecret(ctx.Context, NewSecretRequest(ctx), writer)
+}
+
+// FetchSecret retrieves the secret manager document identified by the request and writes the contents to the
+// specified io.Writer. The `latest` version will be retrieved if no version has been specified.
+func FetchSecret(ctx context.Context, secret SecretRequest, writer io.Writer) error {
 	var client *secretmanager.Client
 	var err error
 
 	// Set the secret manager Client option for reading credentials from a file.
 	clientOptions := make([]option.ClientOption, 0)
-	if !stringutil.IsBlank(ctx.String("key-file")) {
-		clientOptions = append(clientOptions, option.WithCredentialsFile(ctx.String("key-file")))
-	} else if !stringutil.IsBlank(ctx.String("key-value")) {
+	if !stringutil.IsBlank(secret.KeyFile) {
+		clientOptions = append(clientOptions, option.WithCredentialsFile(secret.KeyFile))
+	} else if !stringutil.IsBlank(secret.KeyValue) {
 		var jsonBytes []byte
-		jsonBytes, err = base64.StdEncoding.DecodeString(ctx.String("key-value"))
+		jsonBytes, err = base64.StdEncoding.DecodeString(secret.KeyValue)
 		if err != nil {
 			return fmt.Errorf("failed to decode secretmanager service account key value: %v", err)
 		}
@@ -34,7 +67,7 @@ func FetchSecretDocument(ctx *cli.Context, writer io.Writer) error {
 	}
 
 	// Create the secret manager Client.
-	if client, err = secretmanager.NewClient(ctx.Context, clientOptions...); err != nil {
+	if client, err = secretmanager.NewClient(ctx, clientOptions...); err != nil {
 		return fmt.Errorf("failed to create secretmanager client: %v", err)
 	}
 	defer func() {
@@ -45,17 +78,17 @@ func FetchSecretDocument(ctx *cli.Context, writer io.Writer) error {
 
 	// Build the request.
 	secretVersion := "latest"
-	if !stringutil.IsBlank(ctx.String("secret-version")) {
-		secretVersion = ctx.String("secret-version")
+	if !stringutil.IsBlank(secret.Version) {
+		secretVersion = secret.Version
 	}
-	secretName := fmt.Sprintf("projects/%s/secrets/%s/versions/%s", ctx.String("project"), ctx.String("secret-name"), secretVersion)
+	secretName := fmt.Sprintf("projects/%s/secrets/%s/versions/%s", secret.Project, secret.Name, secretVersion)
 	request := &secretmanagerpb.AccessSecretVersionRequest{
 		Name: secretName,
 	}
 
 	// Call the API.
 	var result *secretmanagerpb.AccessSecretVersionResponse
-	if result, err = client.AccessSecretVersion(ctx.Context, request); err != nil {
+	if result, err = client.AccessSecretVersion(ctx, request); err != nil {
 		return fmt.Errorf("failed to access secret version: %v", err)
 	}
 
@@ -5,7 +5,7 @@ go 1.15
 require (
 	cloud.google.com/go v0.82.0
 	github.com/cpuguy83/go-md2man/v2 v2.0.0 // indirect
-	github.com/hjson/hjson-go v3.1.0+incompatible
+	github.com/hjson/hjson-go/v4 v4.4.0
 	github.com/kr/text v0.2.0 // indirect
 	github.com/niemeyer/pretty v0.0.0-20200227124842-a10e7caefd8e // indirect
 	github.com/sirupsen/logrus v1.8.1
@@ -6,19 +6,26 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"os/exec"
 	"runtime"
+	"strconv"
+	"strings"
 	"syscall"
 	cliTemplate "text/template"
 
-	"github.com/hjson/hjson-go"
+	"github.com/hjson/hjson-go/v4"
 	"github.com/sirupsen/logrus"
 	"github.com/urfave/cli/v2"
 
+	"github.com/markeissler/injector/format"
 	"github.com/markeissler/injector/gcp"
+	"github.com/markeissler/injector/pkg/jsonschema"
 	"github.com/markeissler/injector/pkg/jsonutil"
 	"github.com/markeissler/injector/pkg/numericutil"
+	"github.com/markeissler/injector/pkg/sdnotify"
+	"github.com/markeissler/injector/pkg/secretfiles"
 	"github.com/markeissler/injector/pkg/signal"
 	"github.com/markeissler/injector/pkg/stringutil"
 	"github.com/markeissler/injector/template"
@@ -26,14 +33,24 @@ import (
 
 const (
 	appName                     = "inject"
-	exportedOutputFormatter     = `export %s="%s"`
-	unexportedOutputFormatter   = `%s="%s"`
 	unquotedOutputFormatter     = `%s=%s`
 	jsonIndent                  = `    `
+	defaultRoot                 = "environment"
+	mappingRoot                 = "mapping"
+	filesRoot                   = "files"
+	argsRoot                    = "args"
+	defaultsRoot                = "defaults"
+	requiredRoot                = "required"
+	notifyModeRelay             = "relay"
+	notifyModePassthrough       = "passthrough"
+	notifyModeNone              = "none"
 	envVarInjectorKeyValue      = "INJECTOR_KEY_VALUE"
 	envVarInjectorProject       = "INJECTOR_PROJECT"
 	envVarInjectorSecretName    = "INJECTOR_SECRET_NAME"
 	envVarInjectorSecretVersion = "INJECTOR_SECRET_VERSION"
+	envVarInjectorEnvName       = "INJECTOR_ENV_NAME"
+	selectorEnvName             = "env"
+	selectorHostname            = "hostname"
 )
 
 var (
@@ -49,18 +66,12 @@ var (
 	Platform = ""
 	// Logger
 	log = logrus.New()
+	// fetchSecret retrieves secret manager documents by request (replaced in tests).
+	fetchSecret gcp.FetchFunc = gcp.FetchSecret
 )
 
 func main() {
-	app := &cli.App{
-		Name:                   appName,
-		HelpName:               appName,
-		Usage:                  "Handle signals and inject environment variables from GCP secret manager.",
-		Action:                 run,
-		Version:                Version,
-		UseShortOptionHandling: true,
-		Flags:                  flags(),
-	}
+	app := newApp()
 
 	cli.AppHelpTemplate = template.AppHelpTemplate()
 	cli.HelpPrinter = func(out io.Writer, templ string, data interface{}) {
@@ -85,6 +96,25 @@ func main() {
 	}
 }
 
+// newApp returns the cli application with its global options and commands.
+func newApp() *cli.App {
+	return &cli.App{
+		Name:                   appName,
+		HelpName:               appName,
+		Usage:                  "Handle signals and inject environment variables from GCP secret manager.",
+		Action:                 run,
+		Version:                Version,
+		UseShortOptionHandling: true,
+		Flags:                  flags(),
+		Commands: []*cli.Command{
+			terraformCommand(),
+			validateCommand(),
+			docsCommand(),
+			codegenCommand(),
+		},
+	}
+}
+
 // debug outputs version information, resolved inputs from cli options and environment variables to the specified
 // io.Writer.
 func debug(ctx *cli.Context, writer io.Writer) {
@@ -132,35 +162,208 @@ func flags() []cli.Flag {
 			Required: false,
 			EnvVars:  []string{envVarInjectorKeyValue},
 		},
-		// format-shell outputs contents from the secret document as a list of exported shell key/value settings. A
-		// typical use case would be to write the output to a file and then `source` it elsewhere.
+		// format sets the output format for contents from the secret document. When no format is specified the secret
+		// document contents will be injected into the environment of the command to run. A typical use case would be
+		// to write the output to a file and then `source` or otherwise load it elsewhere.
+		&cli.StringFlag{
+			Name:    "format",
+			Aliases: []string{"f"},
+			Usage: fmt.Sprintf("Parse secret contents and convert to the specified format (%s).",
+				strings.Join(format.Names(), ", ")),
+			Required: false,
+		},
+		// root selects the part of the secret document from which environment variables are flattened using a path
+		// with elements separated by periods (e.g. `services.billing.environment`). This option can be specified
+		// multiple times to merge several parts of the document, in order. The default is `environment`.
+		&cli.StringSliceFlag{
+			Name:     "root",
+			Usage:    "Path to the part of the secret document containing environment variables. Can be specified multiple times.",
+			Required: false,
+		},
+		// flatten outputs the environment variable names and values that would be injected into the command instead of
+		// the nested document. This option only applies to structured formats (json, yaml, toml and properties); shell
+		// formats are always flattened.
 		&cli.BoolFlag{
-			Name:     "format-shell",
-			Aliases:  []string{"e"},
-			Usage:    "Parse secret contents and convert to exported shell key/value settings.",
+			Name:     "flatten",
+			Aliases:  []string{"F"},
+			Usage:    "Output flattened environment variable names and values instead of the nested document.",
 			Required: false,
 		},
-		// format-shell-unexported outputs contents from the secret document as a list of shell key/value settings. A
-		// typical use case would be to write the output to a file and then `source` it elsewhere.
+		// interpolate enables the resolution of `${...}` references between values in the secret document. It's off by
+		// default so that values containing literal `${` or `$$` sequences (e.g. passwords) are injected unchanged.
 		&cli.BoolFlag{
-			Name:     "format-shell-unexported",
-			Aliases:  []string{"u"},
-			Usage:    "Parse secret contents and convert to unexported shell key/value settings.",
+			Name:     "interpolate",
+			Usage:    "Resolve ${...} references in values.",
 			Required: false,
 		},
-		// format-json outputs contents from the secret document as a standard JSON object.
+		// interpolate-env allows `${...}` references in values to be resolved from environment variables of the parent
+		// OS when they can't be resolved from the secret document. Parent environment variables can't be referenced
+		// unless this option is specified along with the interpolate option.
 		&cli.BoolFlag{
-			Name:     "format-json",
-			Aliases:  []string{"j"},
-			Usage:    "Parse secret contents and convert from hJSON to JSON.",
+			Name:     "interpolate-env",
+			Usage:    "Resolve ${...} references in values from environment variables of the parent OS.",
+			Required: false,
+		},
+		// rename replaces a generated environment variable name with another name (e.g. `DB_URL=DATABASE_URL`) for
+		// binaries that expect specific names. Renames are added to those in the `mapping` section of the secret
+		// document. This option can be specified multiple times.
+		&cli.StringSliceFlag{
+			Name:     "rename",
+			Usage:    "Rename a generated variable (FROM=TO). Can be specified multiple times.",
+			Required: false,
+		},
+		// alias duplicates a generated environment variable under another name (e.g. `API_TOKEN=GITHUB_TOKEN`). Aliases
+		// are added to those in the `mapping` section of the secret document. This option can be specified multiple
+		// times.
+		&cli.StringSliceFlag{
+			Name:     "alias",
+			Usage:    "Copy a generated variable to an additional name (FROM=TO). Can be specified multiple times.",
+			Required: false,
+		},
+		// require fails before running the command (or writing output) if the named environment variable isn't set, in
+		// addition to those listed by the `required` section of the secret document. This option can be specified
+		// multiple times.
+		&cli.StringSliceFlag{
+			Name:     "require",
+			Usage:    "Fail if the variable isn't set, before running the command. Can be specified multiple times.",
+			Required: false,
+		},
+		// only limits the environment variables injected into the command (or output with flattened formats) to those
+		// whose name (e.g. `NEW_RELIC_*`) or document path (e.g. `environment.new_relic.*`) matches a glob pattern. This
+		// option can be specified multiple times.
+		&cli.StringSliceFlag{
+			Name:     "only",
+			Usage:    "Only inject variables whose name or document path matches the glob pattern. Can be specified multiple times.",
+			Required: false,
+		},
+		// exclude removes environment variables whose name or document path matches a glob pattern. Exclusions are
+		// applied after the only option. This option can be specified multiple times.
+		&cli.StringSliceFlag{
+			Name:     "exclude",
+			Usage:    "Exclude variables whose name or document path matches the glob pattern. Can be specified multiple times.",
+			Required: false,
+		},
+		// shell sets the shell for which the `shell` and `shell-unexported` formats are written. Each shell has its own
+		// syntax for setting variables and its own quoting rules. The default is bash (bourne compatible shells).
+		&cli.StringFlag{
+			Name:     "shell",
+			Usage:    fmt.Sprintf("Shell syntax for shell formats (%s).", strings.Join(format.ShellNames(), ", ")),
+			Required: false,
+		},
+		// key-separator sets the separator used to join document path elements in environment variable names (e.g. `__`
+		// as used by .NET and Spring configuration binders).
+		&cli.StringFlag{
+			Name:     "key-separator",
+			Usage:    "Separator for path elements in environment variable names. (\"_\" if not specified)",
+			Required: false,
+		},
+		// key-case sets the case of document path elements in environment variable names.
+		&cli.StringFlag{
+			Name: "key-case",
+			Usage: fmt.Sprintf("Case of path elements in environment variable names (%s). (\"upper\" if not specified)",
+				strings.Join(jsonutil.KeyCases(), ", ")),
+			Required: false,
+		},
+		// prefix is prepended to every environment variable name so variables can be namespaced (e.g. `MYAPP_`) when
+		// several services share a secret document.
+		&cli.StringFlag{
+			Name:     "prefix",
+			Usage:    "Prefix prepended to every environment variable name.",
+			Required: false,
+		},
+		// strip-prefix is removed from every environment variable name that begins with it, before any prefix is
+		// prepended.
+		&cli.StringFlag{
+			Name:     "strip-prefix",
+			Usage:    "Prefix removed from environment variable names that begin with it.",
+			Required: false,
+		},
+		// array-policy sets how arrays in the secret document are flattened to environment variables. Arrays can be
+		// flattened to one variable per element with the index appended to the name (indexed), to a single variable with
+		// elements joined by the array-separator (join), to a single variable with the array encoded as JSON (json), or
+		// rejected (error).
+		&cli.StringFlag{
+			Name: "array-policy",
+			Usage: fmt.Sprintf("Flatten arrays to environment variables as specified (%s). (\"indexed\" if not specified)",
+				strings.Join(jsonutil.ArrayPolicies(), ", ")),
+			Required: false,
+		},
+		// array-separator sets the separator used to join array elements with the `join` array policy.
+		&cli.StringFlag{
+			Name:     "array-separator",
+			Usage:    `Separator for joined array elements. ("," if not specified)`,
+			Required: false,
+		},
+		// array-policy-for sets the array policy for the array flattened to the named environment variable, overriding
+		// the array-policy option. The value is specified as `NAME=POLICY[:SEPARATOR]` (e.g. `HOSTS=join:;`) and this
+		// option can be specified multiple times.
+		&cli.StringSliceFlag{
+			Name:     "array-policy-for",
+			Usage:    "Flatten the named array as specified (NAME=POLICY[:SEPARATOR]). Can be specified multiple times.",
+			Required: false,
+		},
+		// null-policy sets how null values in the secret document are flattened to environment variables. Null values can
+		// be flattened to empty values (empty), or to variables that are unset (unset) which removes variables of the same
+		// name that would otherwise be inherited with the preserve-env option.
+		&cli.StringFlag{
+			Name: "null-policy",
+			Usage: fmt.Sprintf("Flatten null values to environment variables as specified (%s). (\"empty\" if not specified)",
+				strings.Join(jsonutil.NullPolicies(), ", ")),
+			Required: false,
+		},
+		// bool-format sets how boolean values in the secret document are flattened to environment variables. Quoted
+		// strings (e.g. "false") are not boolean values and are passed through unchanged.
+		&cli.StringFlag{
+			Name: "bool-format",
+			Usage: fmt.Sprintf("Flatten boolean values to environment variables as specified (%s). (\"true-false\" if not specified)",
+				strings.Join(jsonutil.BoolFormats(), ", ")),
 			Required: false,
 		},
-		// format-raw outputs contents from the secret document as returned by the secret manager. The format returned
-		// should be either hJSON (human JSON) or standard JSON.
+		// float-format sets a printf style format (e.g. `%.2f`) for numbers with a fraction or exponent in the secret
+		// document. Numbers are passed through exactly as written in the document if not specified.
+		&cli.StringFlag{
+			Name:     "float-format",
+			Usage:    "Flatten floating point numbers to environment variables with a printf style format (e.g. %.2f).",
+			Required: false,
+		},
+		// name-policy sets how flattened names that aren't valid environment variable names (e.g. a document key
+		// containing a hyphen or a key beginning with a digit) are handled. Invalid names are passed through unchanged
+		// (allow), are an error (error) or have invalid characters replaced with underscores (sanitize).
+		&cli.StringFlag{
+			Name: "name-policy",
+			Usage: fmt.Sprintf("Handle invalid environment variable names as specified (%s). (\"allow\" if not specified)",
+				strings.Join(jsonutil.NamePolicies(), ", ")),
+			Required: false,
+		},
+		// on-collision sets how distinct document paths that flatten to the same environment variable name (e.g. both
+		// `a_b` and `a.b` flatten to `A_B`) are handled. Collisions are an error (error), or the value appearing first
+		// (first) or last (last) in the secret document is kept.
+		&cli.StringFlag{
+			Name: "on-collision",
+			Usage: fmt.Sprintf("Handle environment variable name collisions as specified (%s). (\"error\" if not specified)",
+				strings.Join(jsonutil.CollisionPolicies(), ", ")),
+			Required: false,
+		},
+		// allow-args enables the `args` section of the secret document, whose values are appended to the command
+		// arguments, and the substitution of `${NAME}` references in command arguments with environment variable values.
+		// Command arguments are visible to other users in the process table so this must be enabled explicitly.
 		&cli.BoolFlag{
-			Name:     "format-raw",
-			Aliases:  []string{"r"},
-			Usage:    "Output unparsed secret contents. This will likely be hJSON or JSON.",
+			Name:     "allow-args",
+			Usage:    "Append the args section of the secret document to, and substitute ${NAME} references in, command arguments.",
+			Required: false,
+		},
+		// files-dir sets the directory in which a private directory is created for the files section of the secret
+		// document. The default is a memory backed file system: $XDG_RUNTIME_DIR, /dev/shm or the temporary directory.
+		&cli.StringFlag{
+			Name:     "files-dir",
+			Usage:    "Directory in which secret files are written when wrapping a command.",
+			Required: false,
+		},
+		// files-owner sets the user (and optionally group) that owns secret files, for commands that drop privileges
+		// (e.g. with gosu or su-exec). Files are owned by the user running the injector if not specified.
+		&cli.StringFlag{
+			Name:     "files-owner",
+			Usage:    "User and group that own secret files (USER[:GROUP]).",
 			Required: false,
 		},
 		// ignore would generally be used for deployments where the command line includes one or more secret retrieval
@@ -225,6 +428,48 @@ func flags() []cli.Flag {
 			Required: false,
 			EnvVars:  []string{envVarInjectorSecretVersion},
 		},
+		// env-name selects the conditional blocks of the secret document whose `env` condition matches (e.g. `prod`), so
+		// that a single secret can hold overrides for several environments.
+		&cli.StringFlag{
+			Name:     "env-name",
+			Usage:    "Environment name used to select conditional blocks of the secret document.",
+			Required: false,
+			EnvVars:  []string{envVarInjectorEnvName},
+		},
+		// set defines arbitrary selectors (e.g. `region=eu-west1`) used to select conditional blocks of the secret
+		// document. The `hostname` selector defaults to the hostname. This option can be specified multiple times.
+		&cli.StringSliceFlag{
+			Name:     "set",
+			Usage:    "Selector used to select conditional blocks of the secret document (KEY=VALUE). Can be specified multiple times.",
+			Required: false,
+		},
+		// schema-file represents the path to a JSON Schema (in JSON or HJSON format) that the environment variables part
+		// of the secret document must match before any output is written or the command is run.
+		&cli.StringFlag{
+			Name:     "schema-file",
+			Usage:    "Path to file containing a JSON Schema the environment variables of the secret document must match.",
+			Required: false,
+		},
+		// schema-secret names a secret (`[PROJECT/]SECRET[@VERSION]`) containing the JSON Schema that the environment
+		// variables part of the secret document must match. The project of the secret document is used if no project is
+		// specified.
+		&cli.StringFlag{
+			Name:     "schema-secret",
+			Usage:    "Secret containing a JSON Schema the environment variables of the secret document must match ([PROJECT/]SECRET[@VERSION]).",
+			Required: false,
+		},
+		// notify sets how systemd service manager notifications are handled when the command is run under a service of
+		// `Type=notify` (i.e. when the NOTIFY_SOCKET environment variable is set). In `relay` mode, the injector will
+		// notify the service manager that the service is ready once the command has started and is stopping once the
+		// command has exited. In `passthrough` mode, the NOTIFY_SOCKET environment variable will be passed to the command
+		// so that it can send notifications itself (this requires `NotifyAccess=all` in the unit file). In `none` mode,
+		// notifications are not handled at all.
+		&cli.StringFlag{
+			Name:     "notify",
+			Usage:    `Handle systemd notifications for the command (relay, passthrough, none).`,
+			Value:    notifyModeRelay,
+			Required: false,
+		},
 		// debug enables the output of debugging information which is specifically helpful in identifying misconfigured
 		// and possibly conflicting settings.
 		&cli.BoolFlag{
@@ -240,10 +485,50 @@ func flags() []cli.Flag {
 // functionality and/or when an option is configured via an environment variable while a conflicting option is set from
 // a cli option flag (if specifying both options via cli option flag, for instance, a conflict would also occur).
 func hasConflictingOptions(ctx *cli.Context) (bool, error) {
-	// Disallow conflicting format options.
-	if numericutil.BoolToInt(ctx.Bool("format-shell"))+numericutil.BoolToInt(ctx.Bool("format-shell-unexported"))+
-		numericutil.BoolToInt(ctx.Bool("format-json"))+numericutil.BoolToInt(ctx.Bool("format-raw")) > 1 {
-		return true, errors.New("multiple output formats are not supported")
+	// Disallow flattening of unstructured or unparsed output formats.
+	if outputFormat, err := format.Parse(ctx.String("format")); err != nil {
+		return true, err
+	} else if ctx.Bool("flatten") && !outputFormat.IsStructured() && !outputFormat.IsFlat() {
+		return true, errors.New("flattened output is not supported for the specified format")
+	}
+
+	// Disallow filters for output formats that aren't flattened.
+	if filter := documentFilter(ctx); !filter.IsEmpty() {
+		if err := filter.Validate(); err != nil {
+			return true, err
+		}
+		if outputFormat, _ := format.Parse(ctx.String("format")); outputFormat != format.None && !outputFormat.IsFlat() &&
+			!(outputFormat.IsStructured() && ctx.Bool("flatten")) {
+			return true, errors.New("only and exclude options are only supported for flattened output")
+		}
+	}
+
+	// Disallow shell syntax options for formats other than shell formats.
+	if !stringutil.IsBlank(ctx.String("shell")) {
+		if _, err := format.ParseShell(ctx.String("shell")); err != nil {
+			return true, err
+		}
+		if outputFormat, _ := format.Parse(ctx.String("format")); outputFormat != format.Shell &&
+			outputFormat != format.ShellUnexported {
+			return true, errors.New("shell option is only supported for shell formats")
+		}
+	}
+
+	// Disallow unrecognized service manager notification modes.
+	switch ctx.String("notify") {
+	case notifyModeRelay, notifyModePassthrough, notifyModeNone:
+	default:
+		return true, fmt.Errorf("unsupported notify mode: %s", ctx.String("notify"))
+	}
+
+	// Disallow interpolation from the parent environment unless interpolation is enabled.
+	if ctx.Bool("interpolate-env") && !ctx.Bool("interpolate") {
+		return true, errors.New("interpolate-env option is only supported with the interpolate option")
+	}
+
+	// Disallow conflicting schema source options.
+	if numericutil.StringToBoolInt(ctx.String("schema-file"))+numericutil.StringToBoolInt(ctx.String("schema-secret")) > 1 {
+		return true, errors.New("multiple schema sources are not supported")
 	}
 
 	// Disallow conflicting environment pass through options.
@@ -263,8 +548,8 @@ func hasConflictingOptions(ctx *cli.Context) (bool, error) {
 // has been specified then all dependent options need to be specified as well.
 //
 // Dependencies:
-//	- (key-file or key-value) + project + secret-name
-//	- secret-version + (key-file or key-value) + project + secret-name
+//   - (key-file or key-value) + project + secret-name
+//   - secret-version + (key-file or key-value) + project + secret-name
 //
 // The `secret-version` option cannot be specified without also specifying all other dependent options.
 func hasMissingRetrievalOptions(ctx *cli.Context) (bool, error) {
@@ -307,16 +592,28 @@ func run(ctx *cli.Context) error {
 
 	// Fetch the secret manager document content and copy to a buffer.
 	if wantsToPullSecret(ctx) {
-		if err := gcp.FetchSecretDocument(ctx, &buf); err != nil && !wantsToIgnorePullSecretFailures(ctx) {
+		if err := fetchSecret(ctx.Context, gcp.NewSecretRequest(ctx), &buf); err != nil && !wantsToIgnorePullSecretFailures(ctx) {
 			return err
 		}
 	}
 
-	// Set the output file to either stdout (default) or an actual file.
+	// The format has already been validated by hasConflictingOptions.
+	outputFormat, _ := format.Parse(ctx.String("format"))
+
+	// Set the output file to either stdout (default) or an actual file. The GitHub Actions environment file is used by
+	// default for the github-actions format; it is shared by all steps in a job so it must be appended to.
 	outputFile := os.Stdout
-	if !stringutil.IsBlank(ctx.String("output-file")) && ctx.String("output-file") != "-" {
+	outputPath := ctx.String("output-file")
+	outputFlags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if outputFormat == format.GitHubActions {
+		if stringutil.IsBlank(outputPath) {
+			outputPath = os.Getenv(format.EnvVarGitHubEnv)
+		}
+		outputFlags = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	}
+	if !stringutil.IsBlank(outputPath) && outputPath != "-" {
 		var err error
-		outputFile, err = os.Create(ctx.String("output-file"))
+		outputFile, err = os.OpenFile(outputPath, outputFlags, 0666)
 		if err != nil {
 			return err
 		}
@@ -325,14 +622,21 @@ func run(ctx *cli.Context) error {
 		}()
 	}
 
-	if ctx.Bool("format-json") {
-		return outputJSON(ctx, &buf, outputFile)
-	} else if ctx.Bool("format-raw") {
+	switch {
+	case outputFormat == format.Raw:
 		return outputRaw(ctx, &buf, outputFile)
-	} else if ctx.Bool("format-shell") {
+	case outputFormat == format.Shell:
 		return outputShellExported(ctx, &buf, outputFile)
-	} else if ctx.Bool("format-shell-unexported") {
+	case outputFormat == format.ShellUnexported:
 		return outputShellUnexported(ctx, &buf, outputFile)
+	case outputFormat == format.GitHubActions:
+		return outputGitHubActions(ctx, &buf, outputFile, os.Stdout)
+	case outputFormat.IsFlat(), outputFormat.IsStructured() && ctx.Bool("flatten"):
+		return outputKeyValues(ctx, &buf, outputFile, outputFormat)
+	case outputFormat == format.JSON:
+		return outputJSON(ctx, &buf, outputFile)
+	case outputFormat.IsStructured():
+		return outputDocument(ctx, &buf, outputFile, outputFormat)
 	}
 
 	if err := runCommand(ctx, &buf, ctx.Args().Slice()); err != nil {
@@ -371,17 +675,43 @@ func runCommand(ctx *cli.Context, buf *bytes.Buffer, commandWithArgs []string) e
 	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
 
 	var err error
-	var data map[string]interface{}
+	var data *hjson.OrderedMap
 	if data, err = parseHJSON(ctx, buf); err != nil {
 		return err
 	}
 
-	var envList []string
-	envList, err = convertMapToKeyValueList(ctx, data)
+	// Write the files section of the document to a private directory that is removed when the command exits.
+	var files []jsonutil.KeyValue
+	var filesDir *secretfiles.Dir
+	if files, filesDir, err = materializeFiles(ctx, data); err != nil {
+		log.WithError(err).Error("failed to write secret files")
+		return err
+	}
+	if filesDir != nil {
+		defer func() {
+			if removeErr := filesDir.Remove(); removeErr != nil {
+				log.WithError(removeErr).Error("failed to remove secret files")
+			}
+		}()
+	}
+
+	cmd.Env, err = convertMapToKeyValueList(ctx, data, cmd.Env, files...)
 	if err != nil {
 		log.WithError(err).Error("failed to resolve secrets")
+		return err
 	}
-	cmd.Env = append(cmd.Env, envList...)
+
+	// Pass the service manager notification socket to the command or hide it so that only the injector notifies.
+	notifySocket := sdnotify.Socket()
+	notifyMode := ctx.String("notify")
+	cmd.Env = notifyEnv(cmd.Env, notifyMode, notifySocket)
+
+	// Substitute secret values into the command arguments and append those from the document, only if allowed.
+	if args, err = commandArgs(ctx, data, cmd.Env, args); err != nil {
+		log.WithError(err).Error("failed to resolve command arguments")
+		return err
+	}
+	cmd.Args = append([]string{command}, args...)
 
 	err = cmd.Start()
 	if err != nil {
@@ -392,6 +722,17 @@ func runCommand(ctx *cli.Context, buf *bytes.Buffer, commandWithArgs []string) e
 	// Trap signals and forward to the child process.
 	signal.ForwardToPid(cmd.Process.Pid, log, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM)
 
+	if notifyMode == notifyModeRelay && !stringutil.IsBlank(notifySocket) {
+		if err = sdnotify.Notify(notifySocket, sdnotify.Ready); err != nil {
+			log.WithError(err).Error("failed to notify service manager")
+		}
+		defer func() {
+			if notifyErr := sdnotify.Notify(notifySocket, sdnotify.Stopping); notifyErr != nil {
+				log.WithError(notifyErr).Error("failed to notify service manager")
+			}
+		}()
+	}
+
 	err = cmd.Wait()
 	if err != nil {
 		log.WithError(err).Error("failed to wait for command to complete")
@@ -401,9 +742,243 @@ func runCommand(ctx *cli.Context, buf *bytes.Buffer, commandWithArgs []string) e
 	return nil
 }
 
+// flattenOptions returns the options used to flatten the secret manager document as specified by cli options.
+func flattenOptions(ctx *cli.Context) (jsonutil.Options, error) {
+	options := jsonutil.Options{
+		ArraysByKey: map[string]jsonutil.ArrayOption{},
+	}
+
+	var err error
+	if options.Case, err = jsonutil.ParseKeyCase(ctx.String("key-case")); err != nil {
+		return options, err
+	}
+	options.Separator = ctx.String("key-separator")
+	options.Prefix = ctx.String("prefix")
+	options.StripPrefix = ctx.String("strip-prefix")
+
+	if options.Arrays.Policy, err = jsonutil.ParseArrayPolicy(ctx.String("array-policy")); err != nil {
+		return options, err
+	}
+	options.Arrays.Separator = ctx.String("array-separator")
+
+	if options.Nulls, err = jsonutil.ParseNullPolicy(ctx.String("null-policy")); err != nil {
+		return options, err
+	}
+
+	if options.Booleans, err = jsonutil.ParseBoolFormat(ctx.String("bool-format")); err != nil {
+		return options, err
+	}
+
+	if options.Names, err = jsonutil.ParseNamePolicy(ctx.String("name-policy")); err != nil {
+		return options, err
+	}
+
+	if options.Collisions, err = jsonutil.ParseCollisionPolicy(ctx.String("on-collision")); err != nil {
+		return options, err
+	}
+
+	if err = jsonutil.ValidateFloatFormat(ctx.String("float-format")); err != nil {
+		return options, err
+	}
+	options.FloatFormat = ctx.String("float-format")
+
+	// Key specific array policies are specified as `NAME=POLICY[:SEPARATOR]`.
+	for _, spec := range ctx.StringSlice("array-policy-for") {
+		parts := strings.SplitN(spec, "=", 2)
+		if len(parts) != 2 || stringutil.IsBlank(parts[0]) {
+			return options, fmt.Errorf("invalid array policy for key: %s", spec)
+		}
+
+		var arrayOption jsonutil.ArrayOption
+		policyAndSeparator := strings.SplitN(parts[1], ":", 2)
+		if arrayOption.Policy, err = jsonutil.ParseArrayPolicy(policyAndSeparator[0]); err != nil {
+			return options, err
+		}
+		if len(policyAndSeparator) == 2 {
+			arrayOption.Separator = policyAndSeparator[1]
+		}
+		options.ArraysByKey[strings.TrimSpace(parts[0])] = arrayOption
+	}
+
+	return options, nil
+}
+
+// flattenDocument flattens the environment variables from the parsed secret manager document to a list of key/value
+// pairs as specified by cli options.
+func flattenDocument(ctx *cli.Context, data *hjson.OrderedMap) ([]jsonutil.KeyValue, error) {
+	options, err := flattenOptions(ctx)
+	if err != nil {
+		return []jsonutil.KeyValue{}, err
+	}
+
+	// Only warn about roots that were explicitly specified; a document without the default root is simply empty.
+	for _, root := range ctx.StringSlice("root") {
+		if _, ok := jsonutil.Get(data, root); !ok {
+			log.Warnf("root not found in secret document: %s", root)
+		}
+	}
+
+	list, err := jsonutil.FlattenRoots(data, documentRoots(ctx), options)
+	if err != nil {
+		return list, err
+	}
+
+	// Defaults are filled in before interpolation so that they can be referenced and can themselves contain references.
+	if value, ok := jsonutil.Get(data, defaultsRoot); ok {
+		if list, err = jsonutil.ApplyDefaults(list, value, defaultsRoot, options); err != nil {
+			return list, err
+		}
+	}
+
+	if ctx.Bool("interpolate") {
+		if list, err = jsonutil.Interpolate(data, list, interpolationEnvironment(ctx), options); err != nil {
+			return list, err
+		}
+	}
+
+	mapping, err := documentMapping(ctx, data)
+	if err != nil {
+		return list, err
+	}
+	if list, err = mapping.Apply(list, options); err != nil {
+		return list, err
+	}
+
+	list, removed := documentFilter(ctx).Apply(list)
+
+	// Filtered variables are written to stderr so they won't be mixed with formatted output.
+	if ctx.Bool("debug") {
+		for _, kv := range removed {
+			fmt.Fprintf(os.Stderr, "filtered: %s (%s): %s\n", kv.Key, kv.Path, kv.Reason)
+		}
+	}
+
+	return list, nil
+}
+
+// documentRoots returns the paths to the parts of the secret manager document containing environment variables.
+func documentRoots(ctx *cli.Context) []string {
+	if roots := ctx.StringSlice("root"); len(roots) > 0 {
+		return roots
+	}
+
+	return []string{defaultRoot}
+}
+
+// interpolationEnvironment returns the parent environment variables that can be referenced by interpolated values, or
+// nil if referencing them hasn't been enabled.
+func interpolationEnvironment(ctx *cli.Context) map[string]string {
+	if !ctx.Bool("interpolate-env") {
+		return nil
+	}
+
+	environment := make(map[string]string)
+	for _, v := range os.Environ() {
+		parts := strings.SplitN(v, "=", 2)
+		if len(parts) == 2 {
+			environment[parts[0]] = parts[1]
+		}
+	}
+
+	return environment
+}
+
+// checkRequired returns an error listing each of the variables named by the `required` section of the parsed secret
+// manager document or by the require cli option that isn't set by the flattened key/value pairs or the inherited
+// environment.
+func checkRequired(ctx *cli.Context, data *hjson.OrderedMap, list []jsonutil.KeyValue, env []string) error {
+	required := ctx.StringSlice("require")
+	if value, ok := jsonutil.Get(data, requiredRoot); ok {
+		names, err := jsonutil.ParseRequired(value, requiredRoot)
+		if err != nil {
+			return err
+		}
+		required = append(names, required...)
+	}
+
+	inherited := make(map[string]bool, len(env))
+	for _, v := range env {
+		inherited[strings.SplitN(v, "=", 2)[0]] = true
+	}
+
+	options, err := flattenOptions(ctx)
+	if err != nil {
+		return err
+	}
+
+	missing := jsonutil.Missing(list, required, func(name string) bool { return inherited[name] }, options)
+	if len(missing) > 0 {
+		return fmt.Errorf("missing required environment variables: %s", strings.Join(missing, ", "))
+	}
+
+	return nil
+}
+
+// documentMapping returns the renames and aliases for flattened environment variables from the `mapping` section of
+// the parsed secret manager document merged with those specified by cli options. Cli options take precedence.
+func documentMapping(ctx *cli.Context, data *hjson.OrderedMap) (jsonutil.Mapping, error) {
+	mapping := jsonutil.NewMapping()
+
+	if value, ok := jsonutil.Get(data, mappingRoot); ok {
+		var err error
+		if mapping, err = jsonutil.ParseMapping(value); err != nil {
+			return mapping, err
+		}
+	}
+
+	for _, spec := range ctx.StringSlice("rename") {
+		if err := jsonutil.ParseMappingSpec(mapping.Rename, spec); err != nil {
+			return mapping, err
+		}
+	}
+	for _, spec := range ctx.StringSlice("alias") {
+		if err := jsonutil.ParseMappingSpec(mapping.Alias, spec); err != nil {
+			return mapping, err
+		}
+	}
+
+	return mapping, nil
+}
+
+// documentFilter returns the filter for flattened environment variables as specified by cli options.
+func documentFilter(ctx *cli.Context) jsonutil.Filter {
+	return jsonutil.Filter{
+		Only:    ctx.StringSlice("only"),
+		Exclude: ctx.StringSlice("exclude"),
+	}
+}
+
+// removeEnvVar returns the list of key/value strings without entries for the named environment variable.
+func removeEnvVar(env []string, name string) []string {
+	list := make([]string, 0, len(env))
+	for _, v := range env {
+		if !strings.HasPrefix(v, name+"=") {
+			list = append(list, v)
+		}
+	}
+
+	return list
+}
+
+// notifyEnv returns the command environment with the service manager notification socket set for the passthrough
+// notify mode, or removed for other modes. A copy inherited from the parent environment is always removed first so
+// that the socket is listed once.
+func notifyEnv(env []string, notifyMode, notifySocket string) []string {
+	env = removeEnvVar(env, sdnotify.EnvVarNotifySocket)
+	if notifyMode == notifyModePassthrough && !stringutil.IsBlank(notifySocket) {
+		env = append(env, fmt.Sprintf(unquotedOutputFormatter, sdnotify.EnvVarNotifySocket, notifySocket))
+	}
+
+	return env
+}
+
 // convertMapToKeyValueList converts the parsed secret manager document environment variables to an array of key/value
-// strings. This format is suitable for input to the `cmd.Env` string array value.
-func convertMapToKeyValueList(ctx *cli.Context, data map[string]interface{}) ([]string, error) {
+// strings appended to the provided (inherited) environment, followed by any additional key/value pairs (e.g. the paths
+// of secret files). Inherited variables are removed if the document specifies they should be unset. It's an error for
+// an additional pair to have the same name as a document variable. This format is suitable for input to the `cmd.Env`
+// string array value.
+func convertMapToKeyValueList(ctx *cli.Context, data *hjson.OrderedMap, env []string, additional ...jsonutil.KeyValue) (
+	[]string, error) {
 	if ctx == nil {
 		return []string{}, errors.New("invalid context")
 	}
@@ -412,30 +987,168 @@ func convertMapToKeyValueList(ctx *cli.Context, data map[string]interface{}) ([]
 		return []string{}, errors.New("invalid environment map")
 	}
 
-	var jsonBytes []byte
-	var err error
-	if jsonBytes, err = json.Marshal(data); err != nil {
+	list, err := flattenDocument(ctx, data)
+	if err != nil {
 		return []string{}, err
 	}
 
-	return jsonutil.Flatten(jsonBytes, "environment", unquotedOutputFormatter), nil
+	paths := make(map[string]string, len(list))
+	for _, kv := range list {
+		paths[kv.Key] = kv.Path
+	}
+	for _, kv := range additional {
+		if path, ok := paths[kv.Key]; ok {
+			return []string{}, fmt.Errorf("environment variable name collision: %s (from %s and %s)", kv.Key, path, kv.Path)
+		}
+	}
+	list = append(list, additional...)
+
+	if err = checkRequired(ctx, data, list, env); err != nil {
+		return []string{}, err
+	}
+
+	envList := env
+	for _, kv := range list {
+		if kv.Unset {
+			envList = removeEnvVar(envList, kv.Key)
+			continue
+		}
+		envList = append(envList, fmt.Sprintf(unquotedOutputFormatter, kv.Key, kv.Value))
+	}
+
+	return envList, nil
+}
+
+// commandArgs returns the command arguments with `${NAME}` references substituted with values from the command
+// environment, followed by the arguments listed in the `args` section of the parsed secret manager document. Arguments
+// are returned unchanged unless the `allow-args` option has been specified because the arguments of a process are
+// visible to other users in the process table.
+func commandArgs(ctx *cli.Context, data *hjson.OrderedMap, env []string, args []string) ([]string, error) {
+	section, hasSection := jsonutil.Get(data, argsRoot)
+	if !ctx.Bool("allow-args") {
+		if hasSection {
+			log.Warn("args section of the secret document is ignored without the allow-args option")
+		}
+		return args, nil
+	}
+
+	documentArgs := make([]string, 0)
+	if hasSection {
+		list, ok := section.([]interface{})
+		if !ok {
+			return args, errors.New("args must be an array")
+		}
+
+		options, err := flattenOptions(ctx)
+		if err != nil {
+			return args, err
+		}
+		for i, value := range list {
+			var arg string
+			var isDirective bool
+			path := jsonutil.JoinPath(argsRoot, strconv.Itoa(i))
+			if arg, isDirective, err = jsonutil.DecodeDirective(value, path, options); err != nil {
+				return args, err
+			}
+			if !isDirective {
+				switch value.(type) {
+				case *hjson.OrderedMap, []interface{}:
+					return args, fmt.Errorf("args must contain only strings, numbers or booleans: %s", path)
+				}
+				arg = jsonutil.ValueToString(value)
+			}
+			documentArgs = append(documentArgs, arg)
+		}
+	}
+
+	// The last value wins, as it does for the command environment.
+	values := make(map[string]string, len(env))
+	for _, v := range env {
+		if parts := strings.SplitN(v, "=", 2); len(parts) == 2 {
+			values[parts[0]] = parts[1]
+		}
+	}
+	lookup := func(name string) (string, bool) {
+		value, ok := values[name]
+		return value, ok
+	}
+
+	substituted := false
+	expandedArgs := make([]string, 0, len(args)+len(documentArgs))
+	for _, arg := range append(append([]string{}, args...), documentArgs...) {
+		expanded, ok := stringutil.Expand(arg, lookup)
+		substituted = substituted || ok
+		expandedArgs = append(expandedArgs, expanded)
+	}
+
+	if substituted || len(documentArgs) > 0 {
+		log.Warn("secret values in command arguments are visible to other users in the process table")
+	}
+
+	return expandedArgs, nil
+}
+
+// materializeFiles writes the files described by the `files` section of the parsed secret manager document to a new
+// private directory and returns key/value pairs setting each file's environment variable to its path. The returned
+// directory is nil if the document has no files section.
+func materializeFiles(ctx *cli.Context, data *hjson.OrderedMap) ([]jsonutil.KeyValue, *secretfiles.Dir, error) {
+	section, ok := jsonutil.Get(data, filesRoot)
+	if !ok {
+		return []jsonutil.KeyValue{}, nil, nil
+	}
+
+	options, err := flattenOptions(ctx)
+	if err != nil {
+		return []jsonutil.KeyValue{}, nil, err
+	}
+
+	files, err := secretfiles.Parse(section, filesRoot, options)
+	if err != nil {
+		return []jsonutil.KeyValue{}, nil, err
+	}
+
+	owner, err := secretfiles.ParseOwner(ctx.String("files-owner"))
+	if err != nil {
+		return []jsonutil.KeyValue{}, nil, err
+	}
+
+	baseDir := ctx.String("files-dir")
+	if stringutil.IsBlank(baseDir) {
+		baseDir = secretfiles.DefaultBaseDir()
+	}
+
+	dir, err := secretfiles.Materialize(baseDir, files, owner)
+	if err != nil {
+		return []jsonutil.KeyValue{}, nil, err
+	}
+
+	list := make([]jsonutil.KeyValue, 0, len(files))
+	for _, file := range files {
+		list = append(list, jsonutil.KeyValue{
+			Key:   file.EnvVar,
+			Value: dir.FilePath(file),
+			Path:  jsonutil.JoinPath(filesRoot, file.EnvVar),
+		})
+	}
+
+	return list, dir, nil
 }
 
 // outputShellExported writes the secret manager document contents as exported shell key/value variables to the
 // specified io.Writer.
 func outputShellExported(ctx *cli.Context, buffer *bytes.Buffer, writer io.Writer) error {
-	return outputShell(ctx, buffer, writer, exportedOutputFormatter)
+	return outputShell(ctx, buffer, writer, true)
 }
 
 // outputShellUnexported writes the secret manager document contents as unexported shell key/value variables to the
 // specified io.Writer.
 func outputShellUnexported(ctx *cli.Context, buffer *bytes.Buffer, writer io.Writer) error {
-	return outputShell(ctx, buffer, writer, unexportedOutputFormatter)
+	return outputShell(ctx, buffer, writer, false)
 }
 
-// outputShell writes the secret manager document contents as shell environment variables, formatted with the given
-// line formatter string, to the specified io.Writer.
-func outputShell(ctx *cli.Context, buffer *bytes.Buffer, writer io.Writer, formatter string) error {
+// outputShell writes the secret manager document contents as shell environment variables, quoted for the shell
+// specified with the `shell` option, to the specified io.Writer.
+func outputShell(ctx *cli.Context, buffer *bytes.Buffer, writer io.Writer, exported bool) error {
 	if ctx == nil {
 		return errors.New("invalid context")
 	}
@@ -445,23 +1158,100 @@ func outputShell(ctx *cli.Context, buffer *bytes.Buffer, writer io.Writer, forma
 	}
 
 	var err error
-	var data map[string]interface{}
+	var data *hjson.OrderedMap
 	if data, err = parseHJSON(ctx, buffer); err != nil {
 		return err
 	}
 
-	var jsonBytes []byte
-	if jsonBytes, err = json.Marshal(data); err != nil {
+	var dialect format.Dialect
+	if dialect, err = format.ParseShell(ctx.String("shell")); err != nil {
 		return err
 	}
 
-	list := jsonutil.Flatten(jsonBytes, "environment", formatter)
+	var list []jsonutil.KeyValue
+	if list, err = flattenDocument(ctx, data); err != nil {
+		return err
+	}
+	if err = checkRequired(ctx, data, list, nil); err != nil {
+		return err
+	}
+
+	return format.WriteShell(writer, dialect, exported, list)
+}
+
+// outputDocument writes the secret manager document contents, formatted as specified, to the specified io.Writer.
+func outputDocument(ctx *cli.Context, buffer *bytes.Buffer, writer io.Writer, outputFormat format.Format) error {
+	if ctx == nil {
+		return errors.New("invalid context")
+	}
 
-	for _, v := range list {
-		fmt.Fprintf(writer, "%s\n", v)
+	if buffer == nil {
+		return errors.New("invalid buffer")
 	}
 
-	return nil
+	var err error
+	var data *hjson.OrderedMap
+	if data, err = parseHJSON(ctx, buffer); err != nil {
+		return err
+	}
+
+	return format.WriteDocument(writer, outputFormat, data)
+}
+
+// outputKeyValues writes the secret manager document contents as flattened key/value pairs, formatted as specified,
+// to the specified io.Writer.
+func outputKeyValues(ctx *cli.Context, buffer *bytes.Buffer, writer io.Writer, outputFormat format.Format) error {
+	if ctx == nil {
+		return errors.New("invalid context")
+	}
+
+	if buffer == nil {
+		return errors.New("invalid buffer")
+	}
+
+	var err error
+	var data *hjson.OrderedMap
+	if data, err = parseHJSON(ctx, buffer); err != nil {
+		return err
+	}
+
+	var list []jsonutil.KeyValue
+	if list, err = flattenDocument(ctx, data); err != nil {
+		return err
+	}
+	if err = checkRequired(ctx, data, list, nil); err != nil {
+		return err
+	}
+
+	return format.WriteKeyValues(writer, outputFormat, list)
+}
+
+// outputGitHubActions writes the secret manager document contents as flattened key/value pairs to the GitHub Actions
+// environment file, and writes commands to mask each value from workflow logs to the mask io.Writer.
+func outputGitHubActions(ctx *cli.Context, buffer *bytes.Buffer, writer, maskWriter io.Writer) error {
+	if ctx == nil {
+		return errors.New("invalid context")
+	}
+
+	if buffer == nil {
+		return errors.New("invalid buffer")
+	}
+
+	var err error
+	var data *hjson.OrderedMap
+	if data, err = parseHJSON(ctx, buffer); err != nil {
+		return err
+	}
+
+	var list []jsonutil.KeyValue
+	if list, err = flattenDocument(ctx, data); err != nil {
+		return err
+	}
+	if err = checkRequired(ctx, data, list, nil); err != nil {
+		return err
+	}
+
+	return format.WriteGitHubActions(writer, maskWriter, list)
 }
 
 // outputJSON write the secret manager document contents as JSON to the specified io.Writer.
@@ -475,7 +1265,7 @@ func outputJSON(ctx *cli.Context, buffer *bytes.Buffer, writer io.Writer) error
 	}
 
 	var err error
-	var data map[string]interface{}
+	var data *hjson.OrderedMap
 	if data, err = parseHJSON(ctx, buffer); err != nil {
 		return err
 	}
@@ -523,25 +1313,155 @@ func outputRaw(ctx *cli.Context, buffer *bytes.Buffer, writer io.Writer) error {
 	return nil
 }
 
-// parseHJSON parses the raw secret manager document contents in JSON or HJSON content into a map.
-func parseHJSON(ctx *cli.Context, buffer *bytes.Buffer) (map[string]interface{}, error) {
-	data := make(map[string]interface{})
-
+// parseHJSON parses the raw secret manager document contents in JSON or HJSON content into an ordered map. The order
+// of keys and the literal representation of numbers in the document are preserved. The document is the one specified
+// in cli arguments (see parseSecretDocument).
+func parseHJSON(ctx *cli.Context, buffer *bytes.Buffer) (*hjson.OrderedMap, error) {
 	if ctx == nil {
-		return data, errors.New("invalid context")
+		return hjson.NewOrderedMap(), errors.New("invalid context")
 	}
 
+	return parseSecretDocument(ctx, gcp.NewSecretRequest(ctx), buffer)
+}
+
+// parseSecretDocument parses the raw contents of the source secret manager document in JSON or HJSON content into an
+// ordered map, merges it over the documents listed by its include directive and resolves cross-secret references
+// (e.g. `ref+gcpsm://project/secret#path`) in its values. The result is validated against the JSON Schema specified by
+// cli options, if any.
+func parseSecretDocument(ctx *cli.Context, source gcp.SecretRequest, buffer *bytes.Buffer) (*hjson.OrderedMap, error) {
 	if buffer == nil {
-		return data, errors.New("invalid buffer")
+		return hjson.NewOrderedMap(), errors.New("invalid buffer")
 	}
 
-	if err := hjson.Unmarshal(buffer.Bytes(), &data); err != nil {
-		log.Fatal(err)
+	data, err := jsonutil.Parse(buffer.Bytes())
+	if err != nil {
+		return data, err
+	}
+
+	resolver := gcp.Resolver{
+		KeyFile:  source.KeyFile,
+		KeyValue: source.KeyValue,
+		Fetch:    fetchSecret,
+	}
+
+	// Conditional blocks are applied to each document before its includes are resolved so that a block can add
+	// includes and references within blocks that aren't selected are never resolved.
+	selectors, err := conditionSelectors(ctx)
+	if err != nil {
+		return data, err
+	}
+	resolver.Prepare = func(document *hjson.OrderedMap) (*hjson.OrderedMap, error) {
+		selected, _, conditionErr := jsonutil.ApplyConditions(document, selectors)
+		return selected, conditionErr
+	}
+	if data, err = resolver.Prepare(data); err != nil {
+		return data, err
+	}
+
+	var tree *gcp.IncludeTree
+	if data, tree, err = resolver.ResolveIncludes(ctx.Context, source, data); err != nil {
+		return data, err
+	}
+
+	// The include tree is written to stderr so it won't be mixed with formatted output.
+	if ctx.Bool("debug") && len(tree.Includes) > 0 {
+		fmt.Fprintln(os.Stderr, "includes:")
+		if err = tree.Write(os.Stderr); err != nil {
+			return data, err
+		}
+	}
+
+	if err = resolver.ResolveReferences(ctx.Context, source, data); err != nil {
+		return data, err
+	}
+
+	if err = validateDocument(ctx, source, data); err != nil {
+		return data, err
 	}
 
 	return data, nil
 }
 
+// validateDocument validates each of the parts of the parsed secret manager document containing environment variables
+// against the JSON Schema specified by cli options, if any. The returned error wraps the jsonschema.ValidationErrors
+// if the document doesn't match the schema.
+func validateDocument(ctx *cli.Context, source gcp.SecretRequest, data *hjson.OrderedMap) error {
+	schema, err := documentSchema(ctx, source)
+	if err != nil || schema == nil {
+		return err
+	}
+
+	errs := make(jsonschema.ValidationErrors, 0)
+	for _, root := range documentRoots(ctx) {
+		if value, ok := jsonutil.Get(data, root); ok {
+			errs = append(errs, schema.Validate(value, root)...)
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("secret document doesn't match schema: %w", errs)
+	}
+
+	return nil
+}
+
+// documentSchema returns the JSON Schema specified by cli options, read from a file or fetched from a secret named
+// relative to the source secret manager document, or nil if no schema has been specified.
+func documentSchema(ctx *cli.Context, source gcp.SecretRequest) (*jsonschema.Schema, error) {
+	var content []byte
+
+	switch {
+	case !stringutil.IsBlank(ctx.String("schema-file")):
+		var err error
+		if content, err = ioutil.ReadFile(ctx.String("schema-file")); err != nil {
+			return nil, fmt.Errorf("failed to read schema: %v", err)
+		}
+	case !stringutil.IsBlank(ctx.String("schema-secret")):
+		request, err := gcp.ParseSecretName(ctx.String("schema-secret"), source)
+		if err != nil {
+			return nil, err
+		}
+		request.KeyFile, request.KeyValue = source.KeyFile, source.KeyValue
+
+		var buf bytes.Buffer
+		if err = fetchSecret(ctx.Context, request, &buf); err != nil {
+			return nil, err
+		}
+		content = buf.Bytes()
+	default:
+		return nil, nil
+	}
+
+	return jsonschema.Parse(content)
+}
+
+// conditionSelectors returns the selectors used to select conditional blocks of the secret manager document as
+// specified by cli options. The `hostname` selector defaults to the hostname.
+func conditionSelectors(ctx *cli.Context) (map[string]string, error) {
+	selectors := make(map[string]string)
+
+	if hostname, err := os.Hostname(); err == nil {
+		selectors[selectorHostname] = hostname
+	}
+
+	for _, spec := range ctx.StringSlice("set") {
+		parts := strings.SplitN(spec, "=", 2)
+		if len(parts) != 2 || stringutil.IsBlank(parts[0]) {
+			return selectors, fmt.Errorf("invalid selector: %s", spec)
+		}
+		selectors[strings.TrimSpace(parts[0])] = parts[1]
+	}
+
+	if !stringutil.IsBlank(ctx.String("env-name")) {
+		if _, ok := selectors[selectorEnvName]; ok {
+			return selectors, errors.New("env-name option and env selector are not supported together")
+		}
+		selectors[selectorEnvName] = ctx.String("env-name")
+	}
+
+	return selectors, nil
+}
+
 // wantsToPullSecret checks if supplied options indicate the user wants to retrieve a secret manager document.
 func wantsToPullSecret(ctx *cli.Context) bool {
 	// We only need to check if one of the options that would be needed to pull a secret is defined.
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/markeissler/injector/gcp"
+	"github.com/markeissler/injector/pkg/sdnotify"
+)
+
+// stubFetchSecret replaces the secret manager fetch with one that returns documents, keyed by secret name, and
+// records the requests. The returned function restores the secret manager fetch.
+func stubFetchSecret(documents map[string]string) (*[]gcp.SecretRequest, func()) {
+	requests := make([]gcp.SecretRequest, 0)
+	fetchSecret = func(ctx context.Context, secret gcp.SecretRequest, writer io.Writer) error {
+		requests = append(requests, secret)
+		document, ok := documents[secret.Name]
+		if !ok {
+			return errors.New("secret not found: " + secret.Name)
+		}
+		_, err := fmt.Fprintln(writer, document)
+		return err
+	}
+
+	return &requests, func() { fetchSecret = gcp.FetchSecret }
+}
+
+// runTest runs the app with the global options and command in args, fetching the secret named `app` from the
+// document.
+func runTest(document string, args ...string) error {
+	_, restore := stubFetchSecret(map[string]string{"app": document})
+	defer restore()
+
+	global := []string{appName, "--key-file", "key.json", "--project", "my-project", "--secret-name", "app"}
+	return newApp().Run(append(global, args...))
+}
+
+// readTestFile returns the contents of a file written by a test command, or an empty string if it doesn't exist.
+func readTestFile(t *testing.T, path string) string {
+	content, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return ""
+	}
+	require.NoError(t, err)
+
+	return string(content)
+}
+
+const testRunDocument = `{
+	environment: {
+		app: { host: "db.example.com", password: "s3cret" }
+		other: "x"
+	}
+	when: [
+		{ if: { env: "prod" }, environment: { app: { mode: "prod" } } }
+	]
+	files: { APP_TLS_KEY: "key-data" }
+	args: ["--password=${APP_PASSWORD}"]
+	required: ["APP_HOST"]
+}`
+
+func TestMain_RunCommand(t *testing.T) {
+	dir, err := ioutil.TempDir("", "injector-test")
+	require.NoError(t, err)
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	script := `env > "$0/env" && cat "$APP_TLS_KEY" > "$0/key" && echo "$@" > "$0/args"`
+	err = runTest(testRunDocument, "--env-name", "prod", "--exclude", "OTHER", "--allow-args", "--",
+		"sh", "-c", script, dir)
+	require.NoError(t, err)
+
+	env := readTestFile(t, filepath.Join(dir, "env"))
+	assert.Contains(t, env, "APP_HOST=db.example.com\n")
+	assert.Contains(t, env, "APP_PASSWORD=s3cret\n")
+	assert.Contains(t, env, "APP_MODE=prod\n")
+	assert.Contains(t, env, "APP_TLS_KEY=")
+	assert.NotContains(t, env, "OTHER=")
+	assert.Equal(t, "key-data", readTestFile(t, filepath.Join(dir, "key")))
+	assert.Equal(t, "--password=s3cret\n", readTestFile(t, filepath.Join(dir, "args")))
+}
+
+func TestMain_RunCommand_Required(t *testing.T) {
+	dir, err := ioutil.TempDir("", "injector-test")
+	require.NoError(t, err)
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	err = runTest(testRunDocument, "--require", "API_TOKEN", "--", "sh", "-c", `env > "$0/env"`, dir)
+	assert.EqualError(t, err, "missing required environment variables: API_TOKEN")
+	assert.Empty(t, readTestFile(t, filepath.Join(dir, "env")))
+}
+
+func TestMain_Output(t *testing.T) {
+	dir, err := ioutil.TempDir("", "injector-test")
+	require.NoError(t, err)
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	output := filepath.Join(dir, "output.json")
+	err = runTest(testRunDocument, "--env-name", "dev", "--only", "APP_*", "--format", "json", "--flatten",
+		"--output-file", output)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"APP_HOST": "db.example.com", "APP_PASSWORD": "s3cret"}`, readTestFile(t, output))
+}
+
+// setTestEnv sets an environment variable for the duration of a test. The returned function restores its value.
+func setTestEnv(t *testing.T, name, value string) func() {
+	previous, ok := os.LookupEnv(name)
+	require.NoError(t, os.Setenv(name, value))
+
+	return func() {
+		if ok {
+			_ = os.Setenv(name, previous)
+			return
+		}
+		_ = os.Unsetenv(name)
+	}
+}
+
+func TestMain_NotifyEnv(t *testing.T) {
+	inherited := []string{"HOME=/root", "NOTIFY_SOCKET=/run/systemd/notify", "USER=root"}
+
+	env := notifyEnv(inherited, notifyModePassthrough, "/run/systemd/notify")
+	assert.Equal(t, []string{"HOME=/root", "USER=root", "NOTIFY_SOCKET=/run/systemd/notify"}, env)
+
+	for _, mode := range []string{notifyModeRelay, notifyModeNone, ""} {
+		env = notifyEnv(inherited, mode, "/run/systemd/notify")
+		assert.Equal(t, []string{"HOME=/root", "USER=root"}, env, mode)
+	}
+}
+
+func TestMain_RunCommand_NotifyPassthrough(t *testing.T) {
+	dir, err := ioutil.TempDir("", "injector-test")
+	require.NoError(t, err)
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	socket := filepath.Join(dir, "notify.sock")
+	defer setTestEnv(t, sdnotify.EnvVarNotifySocket, socket)()
+
+	err = runTest(testRunDocument, "--preserve-env", "--notify", "passthrough", "--", "sh", "-c", `env > "$0/env"`, dir)
+	require.NoError(t, err)
+
+	env := readTestFile(t, filepath.Join(dir, "env"))
+	assert.Equal(t, 1, strings.Count(env, sdnotify.EnvVarNotifySocket+"="), env)
+	assert.Contains(t, env, sdnotify.EnvVarNotifySocket+"="+socket+"\n")
+}
+
+func TestMain_RunCommand_NotifyRelay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "injector-test")
+	require.NoError(t, err)
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	socket := filepath.Join(dir, "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socket, Net: "unixgram"})
+	require.NoError(t, err)
+	defer func() { _ = conn.Close() }()
+	defer setTestEnv(t, sdnotify.EnvVarNotifySocket, socket)()
+
+	err = runTest(testRunDocument, "--preserve-env", "--notify", "relay", "--", "sh", "-c", `env > "$0/env"`, dir)
+	require.NoError(t, err)
+
+	assert.NotContains(t, readTestFile(t, filepath.Join(dir, "env")), sdnotify.EnvVarNotifySocket+"=")
+
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+	buf := make([]byte, 64)
+	for _, expected := range []string{sdnotify.Ready, sdnotify.Stopping} {
+		n, readErr := conn.Read(buf)
+		require.NoError(t, readErr)
+		assert.Equal(t, expected, string(buf[:n]))
+	}
+}
@@ -0,0 +1,361 @@
+// Package codegen generates typed configuration loaders for the environment variables generated from secret documents.
+package codegen
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/hjson/hjson-go/v4"
+
+	"github.com/markeissler/injector/pkg/jsonutil"
+)
+
+// Language identifies the programming language of generated code.
+type Language string
+
+const (
+	// Go generates a Go package with a Config struct and a Load function.
+	Go Language = "go"
+	// TypeScript generates a TypeScript module with a Config interface and a loadConfig function.
+	TypeScript Language = "ts"
+)
+
+// Languages returns the names of all supported languages.
+func Languages() []string {
+	return []string{string(Go), string(TypeScript)}
+}
+
+// ParseLanguage returns the Language identified by name.
+func ParseLanguage(name string) (Language, error) {
+	switch language := Language(strings.ToLower(strings.TrimSpace(name))); language {
+	case Go, TypeScript:
+		return language, nil
+	}
+
+	return "", fmt.Errorf("unsupported language: %s", name)
+}
+
+// Type is the type of a generated field.
+type Type string
+
+const (
+	// String fields are read as is.
+	String Type = "string"
+	// Int fields are parsed as base 10 integers.
+	Int Type = "int"
+	// Float fields are parsed as floating point numbers.
+	Float Type = "float"
+	// Bool fields are parsed as booleans, written as `true`/`false`, `1`/`0` or `yes`/`no`.
+	Bool Type = "bool"
+)
+
+// TypeOf returns the field Type for a JSON Schema type name (see docgen.Document.Type). Values that aren't numbers or
+// booleans are strings.
+func TypeOf(schemaType string) Type {
+	switch schemaType {
+	case "integer":
+		return Int
+	case "number":
+		return Float
+	case "boolean":
+		return Bool
+	}
+
+	return String
+}
+
+// Field is a generated field, read from the environment variable named by EnvVar.
+type Field struct {
+	EnvVar      string
+	Type        Type
+	Description string
+}
+
+// Describer describes the values of a document by document path (e.g. docgen.Document).
+type Describer interface {
+	// Type returns the JSON Schema type name of the value found at path.
+	Type(path string) string
+	// Comment returns the description of the value found at path.
+	Comment(path string) string
+}
+
+// Fields returns a field for each of the flattened key/value pairs, typed and described by the values they were
+// flattened from. Pairs to be unset are omitted.
+func Fields(list []jsonutil.KeyValue, describer Describer) []Field {
+	fields := make([]Field, 0, len(list))
+	for _, kv := range list {
+		if kv.Unset {
+			continue
+		}
+		fields = append(fields, Field{
+			EnvVar:      kv.Key,
+			Type:        TypeOf(describer.Type(kv.Path)),
+			Description: describer.Comment(kv.Path),
+		})
+	}
+
+	return fields
+}
+
+// schemaDescriber describes the values of a sample document by the schemas they were sampled from.
+type schemaDescriber struct {
+	types    map[string]string
+	comments map[string]string
+}
+
+// Type returns the JSON Schema type name of the value found at path.
+func (d schemaDescriber) Type(path string) string {
+	return d.types[path]
+}
+
+// Comment returns the description of the value found at path.
+func (d schemaDescriber) Comment(path string) string {
+	return d.comments[path]
+}
+
+// Sample returns a sample document with a value of the type of each property described by a JSON Schema (e.g. as
+// generated by docgen.Document.Schema), along with a Describer for its values. The sample can be flattened (with an
+// empty root path) to generate the variable names for the schema. Arrays are sampled with a single element. Schemas
+// without a type are sampled as strings.
+func Sample(schema *hjson.OrderedMap) (*hjson.OrderedMap, Describer, error) {
+	describer := schemaDescriber{types: make(map[string]string), comments: make(map[string]string)}
+
+	sample, err := describer.sample(schema, "")
+	if err != nil {
+		return hjson.NewOrderedMap(), describer, err
+	}
+
+	object, ok := sample.(*hjson.OrderedMap)
+	if !ok {
+		return hjson.NewOrderedMap(), describer, fmt.Errorf("schema must describe an object")
+	}
+
+	return object, describer, nil
+}
+
+// sample returns a sample value for the schema found at path, recording its type and description.
+func (d schemaDescriber) sample(value interface{}, path string) (interface{}, error) {
+	schema, ok := value.(*hjson.OrderedMap)
+	if !ok {
+		return nil, fmt.Errorf("schema must be an object: %s", pathOrRoot(path))
+	}
+
+	schemaType := "string"
+	switch v := schema.Map["type"].(type) {
+	case string:
+		schemaType = v
+	case []interface{}:
+		// The first type other than null is sampled (e.g. `["string", "null"]`).
+		for _, item := range v {
+			if name, ok := item.(string); ok && name != "null" {
+				schemaType = name
+				break
+			}
+		}
+	}
+	if _, ok := schema.Map["properties"]; ok && schema.Map["type"] == nil {
+		schemaType = "object"
+	}
+
+	d.types[path] = schemaType
+	if description, ok := schema.Map["description"].(string); ok {
+		d.comments[path] = description
+	}
+
+	switch schemaType {
+	case "object":
+		return d.sampleObject(schema, path)
+	case "array":
+		items, ok := schema.Map["items"]
+		if !ok {
+			return []interface{}{}, nil
+		}
+		item, err := d.sample(items, jsonutil.JoinPath(path, "0"))
+		if err != nil {
+			return nil, err
+		}
+		if d.comments[jsonutil.JoinPath(path, "0")] == "" {
+			d.comments[jsonutil.JoinPath(path, "0")] = d.comments[path]
+		}
+		return []interface{}{item}, nil
+	case "integer":
+		return json.Number("0"), nil
+	case "number":
+		return json.Number("0.5"), nil
+	case "boolean":
+		return false, nil
+	}
+
+	return "", nil
+}
+
+// sampleObject returns a sample object with a value for each of the properties of the schema found at path.
+func (d schemaDescriber) sampleObject(schema *hjson.OrderedMap, path string) (interface{}, error) {
+	object := hjson.NewOrderedMap()
+
+	properties, ok := schema.Map["properties"].(*hjson.OrderedMap)
+	if !ok {
+		return object, nil
+	}
+
+	for _, key := range properties.Keys {
+		value, err := d.sample(properties.Map[key], jsonutil.JoinPath(path, key))
+		if err != nil {
+			return nil, err
+		}
+		object.Set(key, value)
+	}
+
+	return object, nil
+}
+
+// pathOrRoot returns the path, or a description of the root for an empty path.
+func pathOrRoot(path string) string {
+	if path == "" {
+		return "(root)"
+	}
+
+	return path
+}
+
+// Options are the options for generated code.
+type Options struct {
+	// Package is the name of the generated Go package, `config` if not specified.
+	Package string
+}
+
+// Generate writes the code for a typed configuration loader with one field per environment variable, in the specified
+// language, to the io.Writer. Every variable is required by the loader.
+func Generate(writer io.Writer, language Language, fields []Field, options Options) error {
+	switch language {
+	case Go:
+		return writeGo(writer, fields, options)
+	case TypeScript:
+		return writeTypeScript(writer, fields)
+	}
+
+	return fmt.Errorf("unsupported language: %s", language)
+}
+
+// commonInitialisms are the words written in upper case within Go identifiers.
+var commonInitialisms = map[string]bool{
+	"ACL": true, "API": true, "ASCII": true, "CPU": true, "CSS": true, "DB": true, "DNS": true, "EOF": true,
+	"GCP": true, "GUID": true, "HTML": true, "HTTP": true, "HTTPS": true, "ID": true, "IP": true, "JSON": true,
+	"JWT": true, "LHS": true, "QPS": true, "RAM": true, "RHS": true, "RPC": true, "SLA": true, "SMTP": true,
+	"SQL": true, "SSH": true, "TCP": true, "TLS": true, "TTL": true, "UDP": true, "UI": true, "UID": true,
+	"URI": true, "URL": true, "UTF8": true, "UUID": true, "VM": true, "XML": true, "XMPP": true, "XSRF": true,
+	"XSS": true,
+}
+
+// words returns the words of an environment variable name, split at characters other than letters and digits (e.g.
+// underscores) and at lower to upper case transitions (e.g. `DATABASE_URL` and `databaseUrl` both have the words
+// `database` and `url`), in lower case.
+func words(name string) []string {
+	s := make([]string, 0)
+	parts := strings.FieldsFunc(name, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for _, part := range parts {
+		var word []rune
+		runes := []rune(part)
+		for i, r := range runes {
+			if i > 0 && unicode.IsUpper(r) && unicode.IsLower(runes[i-1]) {
+				s = append(s, strings.ToLower(string(word)))
+				word = word[:0]
+			}
+			word = append(word, r)
+		}
+		if len(word) > 0 {
+			s = append(s, strings.ToLower(string(word)))
+		}
+	}
+
+	return s
+}
+
+// identifier returns an identifier for a field read from the named environment variable: exported camel case with
+// common initialisms in upper case for Go (e.g. `DatabaseURL`), or lower camel case for TypeScript (e.g.
+// `databaseUrl`). Identifiers that would begin with a digit, or for Go with a letter that has no upper case, are
+// prefixed with a `V` (`v` for TypeScript) so that Go fields remain exported (e.g. `1_FOO` becomes `V1Foo`).
+func identifier(name string, language Language) string {
+	var b strings.Builder
+	for i, word := range words(name) {
+		switch {
+		case language == Go && commonInitialisms[strings.ToUpper(word)]:
+			b.WriteString(strings.ToUpper(word))
+		case language == TypeScript && i == 0:
+			b.WriteString(word)
+		default:
+			r, size := utf8.DecodeRuneInString(word)
+			b.WriteRune(unicode.ToUpper(r))
+			b.WriteString(word[size:])
+		}
+	}
+
+	id := b.String()
+	first, _ := utf8.DecodeRuneInString(id)
+	if id == "" || unicode.IsDigit(first) || (language == Go && !unicode.IsUpper(first)) {
+		prefix := "V"
+		if language == TypeScript {
+			prefix = "v"
+		}
+		id = prefix + id
+	}
+
+	return id
+}
+
+// identifiers returns the identifier of each field, in order. It's an error for two fields to have the same
+// identifier (e.g. `DB_URL` and `DbUrl`).
+func identifiers(fields []Field, language Language) ([]string, error) {
+	ids := make([]string, 0, len(fields))
+	names := make(map[string]string, len(fields))
+	for _, field := range fields {
+		id := identifier(field.EnvVar, language)
+		if previous, ok := names[id]; ok {
+			return []string{}, fmt.Errorf("field name collision: %s (from %s and %s)", id, previous, field.EnvVar)
+		}
+		names[id] = field.EnvVar
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
+
+// quoteGo returns a double quoted Go string literal.
+func quoteGo(s string) string {
+	return strconv.Quote(s)
+}
+
+// quoteTypeScript returns a double quoted TypeScript string literal. Characters that aren't printable are written as
+// code point escapes (e.g. `\u{7}`) because TypeScript doesn't support Go escapes such as `\a` and `\U0001F600`.
+func quoteTypeScript(s string) string {
+	var b strings.Builder
+
+	b.WriteRune('"')
+	for _, r := range s {
+		switch {
+		case r == '\\' || r == '"':
+			b.WriteRune('\\')
+			b.WriteRune(r)
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '\r':
+			b.WriteString(`\r`)
+		case r == '\t':
+			b.WriteString(`\t`)
+		case !unicode.IsPrint(r):
+			fmt.Fprintf(&b, `\u{%x}`, r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	b.WriteRune('"')
+
+	return b.String()
+}
@@ -0,0 +1,134 @@
+package codegen_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/markeissler/injector/pkg/codegen"
+	"github.com/markeissler/injector/pkg/docgen"
+	"github.com/markeissler/injector/pkg/jsonutil"
+)
+
+const testDocument = `{
+    environment: {
+        // Connection string for the primary database.
+        database_url: "postgres://db.example.com/app"
+        port: 8080
+        ratio: 0.5
+        app: { debug: false }
+        proxy: null
+    }
+}`
+
+func testFields(t *testing.T) []codegen.Field {
+	d, err := docgen.Parse([]byte(testDocument))
+	require.NoError(t, err)
+
+	data, err := jsonutil.Parse([]byte(testDocument))
+	require.NoError(t, err)
+	list, err := jsonutil.FlattenKeyValues(data, "environment", jsonutil.Options{Nulls: jsonutil.NullUnset})
+	require.NoError(t, err)
+
+	return codegen.Fields(list, d)
+}
+
+func TestCodegen_Fields(t *testing.T) {
+	expected := []codegen.Field{
+		{EnvVar: "DATABASE_URL", Type: codegen.String, Description: "Connection string for the primary database."},
+		{EnvVar: "PORT", Type: codegen.Int},
+		{EnvVar: "RATIO", Type: codegen.Float},
+		{EnvVar: "APP_DEBUG", Type: codegen.Bool},
+	}
+	assert.Equal(t, expected, testFields(t))
+}
+
+func TestCodegen_Generate_Go(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, codegen.Generate(&buf, codegen.Go, testFields(t), codegen.Options{Package: "settings"}))
+
+	code := buf.String()
+	assert.Contains(t, code, "package settings\n")
+	assert.Contains(t, code, "\t// DatabaseURL is read from DATABASE_URL. Connection string for the primary database.\n"+
+		"\tDatabaseURL string\n")
+	assert.Contains(t, code, "\tPort int64\n")
+	assert.Contains(t, code, "\tRatio float64\n")
+	assert.Contains(t, code, "\tAppDebug bool\n")
+	assert.Contains(t, code, "\tif c.Port, err = lookupInt(\"PORT\"); err != nil {\n")
+
+	err := codegen.Generate(&buf, codegen.Go, []codegen.Field{}, codegen.Options{Package: "my-config"})
+	assert.EqualError(t, err, "invalid package name: my-config")
+}
+
+func TestCodegen_Generate_TypeScript(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, codegen.Generate(&buf, codegen.TypeScript, testFields(t), codegen.Options{}))
+
+	code := buf.String()
+	assert.Contains(t, code, "  /** Read from DATABASE_URL. Connection string for the primary database. */\n"+
+		"  readonly databaseUrl: string;\n")
+	assert.Contains(t, code, "  readonly port: number;\n")
+	assert.Contains(t, code, "  readonly appDebug: boolean;\n")
+	assert.Contains(t, code, "    ratio: lookupFloat(env, \"RATIO\"),\n")
+}
+
+func TestCodegen_Generate_Names(t *testing.T) {
+	fields := []codegen.Field{
+		{EnvVar: "1_FOO", Type: codegen.String},
+		{EnvVar: "NEW-RELIC_KEY", Type: codegen.String},
+		{EnvVar: "ÉCOLE_ÂGE", Type: codegen.String},
+		{EnvVar: "名前", Type: codegen.String},
+		{EnvVar: "TAG\a\U000E0001\U0001F600\"", Type: codegen.String},
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, codegen.Generate(&buf, codegen.Go, fields, codegen.Options{}))
+	code := buf.String()
+	assert.Contains(t, code, "\tV1Foo string\n")
+	assert.Contains(t, code, "\tNewRelicKey string\n")
+	assert.Contains(t, code, "\tÉcoleÂge string\n")
+	assert.Contains(t, code, "\tV名前 string\n")
+	assert.Contains(t, code, "\tif c.Tag, err = lookupString(\"TAG\\a\\U000e0001\U0001F600\\\"\"); err != nil {\n")
+
+	buf.Reset()
+	require.NoError(t, codegen.Generate(&buf, codegen.TypeScript, fields, codegen.Options{}))
+	code = buf.String()
+	assert.Contains(t, code, "    v1Foo: lookupString(env, \"1_FOO\"),\n")
+	assert.Contains(t, code, "    newRelicKey: lookupString(env, \"NEW-RELIC_KEY\"),\n")
+	assert.Contains(t, code, "    écoleÂge: lookupString(env, \"ÉCOLE_ÂGE\"),\n")
+	assert.Contains(t, code, "    名前: lookupString(env, \"名前\"),\n")
+	assert.Contains(t, code, "    tag: lookupString(env, \"TAG\\u{7}\\u{e0001}\U0001F600\\\"\"),\n")
+}
+
+func TestCodegen_Generate_Collision(t *testing.T) {
+	fields := []codegen.Field{{EnvVar: "DB_URL", Type: codegen.String}, {EnvVar: "DbUrl", Type: codegen.String}}
+
+	var buf bytes.Buffer
+	err := codegen.Generate(&buf, codegen.Go, fields, codegen.Options{})
+	assert.EqualError(t, err, "field name collision: DBURL (from DB_URL and DbUrl)")
+}
+
+func TestCodegen_Sample(t *testing.T) {
+	d, err := docgen.Parse([]byte(testDocument))
+	require.NoError(t, err)
+
+	sample, describer, err := codegen.Sample(d.Schema([]string{"environment"}))
+	require.NoError(t, err)
+
+	list, err := jsonutil.FlattenRoots(sample, []string{""}, jsonutil.Options{Nulls: jsonutil.NullUnset})
+	require.NoError(t, err)
+
+	expected := []codegen.Field{
+		{EnvVar: "DATABASE_URL", Type: codegen.String, Description: "Connection string for the primary database."},
+		{EnvVar: "PORT", Type: codegen.Int},
+		{EnvVar: "RATIO", Type: codegen.Float},
+		{EnvVar: "APP_DEBUG", Type: codegen.Bool},
+		{EnvVar: "PROXY", Type: codegen.String},
+	}
+	assert.Equal(t, expected, codegen.Fields(list, describer))
+
+	_, err = codegen.ParseLanguage("rust")
+	assert.EqualError(t, err, "unsupported language: rust")
+}
@@ -0,0 +1,136 @@
+package codegen
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"go/token"
+	"io"
+	"strings"
+)
+
+// goTypes are the Go types of fields and the functions used to read them.
+var goTypes = map[Type]struct{ name, lookup string }{
+	String: {"string", "lookupString"},
+	Int:    {"int64", "lookupInt"},
+	Float:  {"float64", "lookupFloat"},
+	Bool:   {"bool", "lookupBool"},
+}
+
+// goHelpers are the functions used by generated Go code to read fields from the environment.
+const goHelpers = `
+// lookupString returns the value of the named environment variable.
+func lookupString(name string) (string, error) {
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return "", fmt.Errorf("missing environment variable: %s", name)
+	}
+
+	return value, nil
+}
+
+// lookupInt returns the value of the named environment variable as an integer.
+func lookupInt(name string) (int64, error) {
+	value, err := lookupString(name)
+	if err != nil {
+		return 0, err
+	}
+
+	i, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid integer environment variable: %s", name)
+	}
+
+	return i, nil
+}
+
+// lookupFloat returns the value of the named environment variable as a floating point number.
+func lookupFloat(name string) (float64, error) {
+	value, err := lookupString(name)
+	if err != nil {
+		return 0, err
+	}
+
+	f, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number environment variable: %s", name)
+	}
+
+	return f, nil
+}
+
+// lookupBool returns the value of the named environment variable as a boolean.
+func lookupBool(name string) (bool, error) {
+	value, err := lookupString(name)
+	if err != nil {
+		return false, err
+	}
+
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "true", "1", "yes":
+		return true, nil
+	case "false", "0", "no":
+		return false, nil
+	}
+
+	return false, fmt.Errorf("invalid boolean environment variable: %s", name)
+}
+`
+
+// writeGo writes a Go package with a Config struct and a Load function that reads it from the environment.
+func writeGo(writer io.Writer, fields []Field, options Options) error {
+	ids, err := identifiers(fields, Go)
+	if err != nil {
+		return err
+	}
+
+	pkg := options.Package
+	if pkg == "" {
+		pkg = "config"
+	}
+	if !token.IsIdentifier(pkg) {
+		return fmt.Errorf("invalid package name: %s", pkg)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("// Code generated by inject codegen; DO NOT EDIT.\n\n")
+	fmt.Fprintf(&buf, "package %s\n\n", pkg)
+	buf.WriteString("import (\n\t\"fmt\"\n\t\"os\"\n\t\"strconv\"\n\t\"strings\"\n)\n\n")
+
+	buf.WriteString("// Config holds the environment variables injected from the secret document.\n")
+	buf.WriteString("type Config struct {\n")
+	for i, field := range fields {
+		fmt.Fprintf(&buf, "\t// %s is read from %s.", ids[i], field.EnvVar)
+		if field.Description != "" {
+			fmt.Fprintf(&buf, " %s", singleLine(field.Description))
+		}
+		fmt.Fprintf(&buf, "\n\t%s %s\n", ids[i], goTypes[field.Type].name)
+	}
+	buf.WriteString("}\n\n")
+
+	buf.WriteString("// Load reads the Config from the environment. An error is returned if a variable isn't set or can't be parsed.\n")
+	buf.WriteString("func Load() (*Config, error) {\n")
+	buf.WriteString("\tc := &Config{}\n")
+	if len(fields) > 0 {
+		buf.WriteString("\tvar err error\n\n")
+	}
+	for i, field := range fields {
+		fmt.Fprintf(&buf, "\tif c.%s, err = %s(%s); err != nil {\n\t\treturn nil, err\n\t}\n",
+			ids[i], goTypes[field.Type].lookup, quoteGo(field.EnvVar))
+	}
+	buf.WriteString("\n\treturn c, nil\n}\n")
+	buf.WriteString(goHelpers)
+
+	source, err := format.Source(buf.Bytes())
+	if err != nil {
+		return fmt.Errorf("failed to format generated code: %v", err)
+	}
+
+	_, err = writer.Write(source)
+	return err
+}
+
+// singleLine returns text with line breaks replaced by spaces, for use within a single line comment.
+func singleLine(text string) string {
+	return strings.Join(strings.Fields(text), " ")
+}
@@ -0,0 +1,95 @@
+package codegen
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// typeScriptTypes are the TypeScript types of fields and the functions used to read them.
+var typeScriptTypes = map[Type]struct{ name, lookup string }{
+	String: {"string", "lookupString"},
+	Int:    {"number", "lookupInt"},
+	Float:  {"number", "lookupFloat"},
+	Bool:   {"boolean", "lookupBool"},
+}
+
+// typeScriptHelpers are the functions used by generated TypeScript code to read fields from the environment.
+const typeScriptHelpers = `
+type Env = Record<string, string | undefined>;
+
+function lookupString(env: Env, name: string): string {
+  const value = env[name];
+  if (value === undefined) {
+    throw new Error(` + "`missing environment variable: ${name}`" + `);
+  }
+  return value;
+}
+
+function lookupInt(env: Env, name: string): number {
+  const value = lookupString(env, name).trim();
+  if (!/^[+-]?\d+$/.test(value)) {
+    throw new Error(` + "`invalid integer environment variable: ${name}`" + `);
+  }
+  return Number(value);
+}
+
+function lookupFloat(env: Env, name: string): number {
+  const value = Number(lookupString(env, name).trim());
+  if (Number.isNaN(value)) {
+    throw new Error(` + "`invalid number environment variable: ${name}`" + `);
+  }
+  return value;
+}
+
+function lookupBool(env: Env, name: string): boolean {
+  switch (lookupString(env, name).trim().toLowerCase()) {
+    case "true":
+    case "1":
+    case "yes":
+      return true;
+    case "false":
+    case "0":
+    case "no":
+      return false;
+  }
+  throw new Error(` + "`invalid boolean environment variable: ${name}`" + `);
+}
+`
+
+// writeTypeScript writes a TypeScript module with a Config interface and a loadConfig function that reads it from the
+// environment (`process.env` by default).
+func writeTypeScript(writer io.Writer, fields []Field) error {
+	ids, err := identifiers(fields, TypeScript)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("// Code generated by inject codegen; DO NOT EDIT.\n\n")
+
+	buf.WriteString("/** Config holds the environment variables injected from the secret document. */\n")
+	buf.WriteString("export interface Config {\n")
+	for i, field := range fields {
+		comment := fmt.Sprintf("Read from %s.", field.EnvVar)
+		if field.Description != "" {
+			comment += " " + singleLine(field.Description)
+		}
+		fmt.Fprintf(&buf, "  /** %s */\n", strings.ReplaceAll(comment, "*/", "*\\/"))
+		fmt.Fprintf(&buf, "  readonly %s: %s;\n", ids[i], typeScriptTypes[field.Type].name)
+	}
+	buf.WriteString("}\n\n")
+
+	buf.WriteString("/** Reads the Config from the environment. Throws if a variable isn't set or can't be parsed. */\n")
+	buf.WriteString("export function loadConfig(env: Env = process.env): Config {\n")
+	buf.WriteString("  return {\n")
+	for i, field := range fields {
+		fmt.Fprintf(&buf, "    %s: %s(env, %s),\n", ids[i], typeScriptTypes[field.Type].lookup, quoteTypeScript(field.EnvVar))
+	}
+	buf.WriteString("  };\n}\n")
+	buf.WriteString(typeScriptHelpers)
+
+	_, err = writer.Write(buf.Bytes())
+	return err
+}
@@ -0,0 +1,261 @@
+// Package docgen generates documentation for secret documents from the comments that describe their values.
+package docgen
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/hjson/hjson-go/v4"
+
+	"github.com/markeissler/injector/pkg/jsonutil"
+)
+
+// SchemaVersion is the JSON Schema dialect of generated schemas.
+const SchemaVersion = "http://json-schema.org/draft-07/schema#"
+
+// Document is a parsed document that preserves the comments that describe its values.
+type Document struct {
+	nodes   map[string]*hjson.Node
+	parents map[string]string
+}
+
+// Parse parses JSON or HJSON content, preserving comments. Like jsonutil.Parse, the order of keys and the literal
+// representation of numbers are preserved and blank content is parsed as an empty object.
+func Parse(data []byte) (*Document, error) {
+	root := &hjson.Node{Value: hjson.NewOrderedMap()}
+	if len(bytes.TrimSpace(data)) > 0 {
+		options := hjson.DefaultDecoderOptions()
+		options.UseJSONNumber = true
+		options.WhitespaceAsComments = false
+		if err := hjson.UnmarshalWithOptions(data, root, options); err != nil {
+			return nil, err
+		}
+	}
+
+	d := &Document{nodes: make(map[string]*hjson.Node), parents: make(map[string]string)}
+	d.index("", root)
+
+	return d, nil
+}
+
+// index records the node, found at path, and the nodes within it by their document path (see jsonutil.JoinPath). The
+// properties of value directives aren't recorded as they're part of the directive.
+func (d *Document) index(path string, node *hjson.Node) {
+	d.nodes[path] = node
+
+	switch v := node.Value.(type) {
+	case *hjson.OrderedMap:
+		if jsonutil.IsDirective(v) {
+			return
+		}
+		for _, key := range v.Keys {
+			if child, ok := v.Map[key].(*hjson.Node); ok {
+				childPath := jsonutil.JoinPath(path, key)
+				d.parents[childPath] = path
+				d.index(childPath, child)
+			}
+		}
+	case []interface{}:
+		for i, item := range v {
+			if child, ok := item.(*hjson.Node); ok {
+				childPath := jsonutil.JoinPath(path, strconv.Itoa(i))
+				d.parents[childPath] = path
+				d.index(childPath, child)
+			}
+		}
+	}
+}
+
+// Comment returns the text of the comments written before, or on the same line as, the value found at path. Array
+// elements without comments are described by the comments of the array.
+func (d *Document) Comment(path string) string {
+	comment := d.ownComment(path)
+	if parent, ok := d.parents[path]; ok && comment == "" {
+		if _, isArray := d.nodes[parent].Value.([]interface{}); isArray {
+			return d.Comment(parent)
+		}
+	}
+
+	return comment
+}
+
+// ownComment returns the text of the comments written before, or on the same line as, the value found at path.
+func (d *Document) ownComment(path string) string {
+	node, ok := d.nodes[path]
+	if !ok {
+		return ""
+	}
+
+	text := make([]string, 0, 3)
+	for _, comment := range []string{node.Cm.Before, node.Cm.Key, node.Cm.After} {
+		if t := commentText(comment); t != "" {
+			text = append(text, t)
+		}
+	}
+
+	return strings.Join(text, " ")
+}
+
+// commentText returns the text of `//`, `#` and `/* */` comments, without comment delimiters, as a single line.
+func commentText(comment string) string {
+	text := make([]string, 0)
+	for _, line := range strings.Split(comment, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, "//"), strings.HasPrefix(line, "/*"):
+			line = line[2:]
+		case strings.HasPrefix(line, "#"), strings.HasPrefix(line, "*") && !strings.HasPrefix(line, "*/"):
+			line = line[1:]
+		}
+		if line = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(line), "*/")); line != "" {
+			text = append(text, line)
+		}
+	}
+
+	return strings.Join(text, " ")
+}
+
+// Type returns the JSON Schema type name of the value found at path (e.g. `string` or `integer`), or an empty string if
+// there is no value at path. The type of a value directive is `string` followed by the name of the directive.
+func (d *Document) Type(path string) string {
+	node, ok := d.nodes[path]
+	if !ok {
+		return ""
+	}
+
+	if jsonutil.IsDirective(node.Value) {
+		return fmt.Sprintf("string (%s)", node.Value.(*hjson.OrderedMap).Keys[0])
+	}
+
+	return schemaType(node.Value)
+}
+
+// schemaType returns the JSON Schema type name of a value. Value directives are strings.
+func schemaType(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case *hjson.OrderedMap:
+		if jsonutil.IsDirective(v) {
+			return "string"
+		}
+		return "object"
+	case json.Number:
+		if _, err := v.Int64(); err == nil {
+			return "integer"
+		}
+	}
+
+	return "number"
+}
+
+// WriteMarkdown writes a Markdown table describing the flattened key/value pairs of the document: the variable names,
+// the types and comments of the values they were flattened from, and their document paths. Values are never written.
+func WriteMarkdown(writer io.Writer, d *Document, list []jsonutil.KeyValue) error {
+	var buf bytes.Buffer
+
+	buf.WriteString("| Variable | Type | Description | Path |\n")
+	buf.WriteString("| --- | --- | --- | --- |\n")
+	for _, kv := range list {
+		fmt.Fprintf(&buf, "| `%s` | %s | %s | `%s` |\n",
+			markdownCell(kv.Key), markdownCell(d.Type(kv.Path)), markdownCell(d.Comment(kv.Path)), markdownCell(kv.Path))
+	}
+
+	_, err := writer.Write(buf.Bytes())
+	return err
+}
+
+// markdownCell escapes text for use within a Markdown table cell.
+func markdownCell(text string) string {
+	return strings.ReplaceAll(text, "|", `\|`)
+}
+
+// Schema returns a JSON Schema skeleton, inferred from the values found at each of the roots of the document, that can
+// be used to validate the roots. The skeleton describes the type and comments of each value and requires the
+// properties found in every root.
+func (d *Document) Schema(roots []string) *hjson.OrderedMap {
+	schema := hjson.NewOrderedMap()
+	schema.Set("$schema", SchemaVersion)
+	if len(roots) == 1 {
+		if comment := d.ownComment(roots[0]); comment != "" {
+			schema.Set("description", comment)
+		}
+	}
+	schema.Set("type", "object")
+
+	properties := hjson.NewOrderedMap()
+	counts := make(map[string]int)
+	found := 0
+	for _, root := range roots {
+		node, ok := d.nodes[root]
+		if !ok || schemaType(node.Value) != "object" {
+			continue
+		}
+		found++
+
+		object := node.Value.(*hjson.OrderedMap)
+		for _, key := range object.Keys {
+			properties.Set(key, d.inferSchema(jsonutil.JoinPath(root, key)))
+			counts[key]++
+		}
+	}
+
+	required := make([]interface{}, 0)
+	for _, key := range properties.Keys {
+		if counts[key] == found {
+			required = append(required, key)
+		}
+	}
+
+	schema.Set("properties", properties)
+	if len(required) > 0 {
+		schema.Set("required", required)
+	}
+
+	return schema
+}
+
+// inferSchema returns the schema inferred from the value found at path. Arrays are described by the schema of their
+// first element.
+func (d *Document) inferSchema(path string) *hjson.OrderedMap {
+	node := d.nodes[path]
+
+	schema := hjson.NewOrderedMap()
+	if comment := d.ownComment(path); comment != "" {
+		schema.Set("description", comment)
+	}
+	schema.Set("type", schemaType(node.Value))
+
+	switch v := node.Value.(type) {
+	case *hjson.OrderedMap:
+		if jsonutil.IsDirective(v) {
+			break
+		}
+		properties := hjson.NewOrderedMap()
+		required := make([]interface{}, 0, v.Len())
+		for _, key := range v.Keys {
+			properties.Set(key, d.inferSchema(jsonutil.JoinPath(path, key)))
+			required = append(required, key)
+		}
+		schema.Set("properties", properties)
+		if len(required) > 0 {
+			schema.Set("required", required)
+		}
+	case []interface{}:
+		if len(v) > 0 {
+			schema.Set("items", d.inferSchema(jsonutil.JoinPath(path, "0")))
+		}
+	}
+
+	return schema
+}
@@ -0,0 +1,118 @@
+package docgen_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/markeissler/injector/pkg/docgen"
+	"github.com/markeissler/injector/pkg/jsonutil"
+)
+
+const testDocument = `// Header comment.
+{
+    // Application settings.
+    "environment": {
+        // Connection string for the primary database.
+        "database_url": "postgres://db.example.com/app",
+        "port": 8080, // Port the server listens on.
+        /* Enabled features,
+         * in order. */
+        "features": [ "search", "export" ],
+        # Private key | PEM encoded.
+        "tls_key": { "$base64": "a2V5" },
+        "app": {
+            "debug": false
+        }
+    }
+}`
+
+func TestDocGen_Comment(t *testing.T) {
+	d, err := docgen.Parse([]byte(testDocument))
+	require.NoError(t, err)
+
+	assert.Equal(t, "Header comment.", d.Comment(""))
+	assert.Equal(t, "Application settings.", d.Comment("environment"))
+	assert.Equal(t, "Connection string for the primary database.", d.Comment("environment.database_url"))
+	assert.Equal(t, "Port the server listens on.", d.Comment("environment.port"))
+	assert.Equal(t, "Enabled features, in order.", d.Comment("environment.features.1"))
+	assert.Equal(t, "", d.Comment("environment.app.debug"))
+	assert.Equal(t, "", d.Comment("environment.missing"))
+
+	assert.Equal(t, "integer", d.Type("environment.port"))
+	assert.Equal(t, "string ($base64)", d.Type("environment.tls_key"))
+	assert.Equal(t, "boolean", d.Type("environment.app.debug"))
+	assert.Equal(t, "", d.Type("environment.tls_key.$base64"))
+}
+
+func TestDocGen_WriteMarkdown(t *testing.T) {
+	d, err := docgen.Parse([]byte(testDocument))
+	require.NoError(t, err)
+
+	data, err := jsonutil.Parse([]byte(testDocument))
+	require.NoError(t, err)
+	list, err := jsonutil.FlattenKeyValues(data, "environment", jsonutil.Options{})
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, docgen.WriteMarkdown(&buf, d, list))
+
+	expected := "| Variable | Type | Description | Path |\n" +
+		"| --- | --- | --- | --- |\n" +
+		"| `DATABASE_URL` | string | Connection string for the primary database. | `environment.database_url` |\n" +
+		"| `PORT` | integer | Port the server listens on. | `environment.port` |\n" +
+		"| `FEATURES_0` | string | Enabled features, in order. | `environment.features.0` |\n" +
+		"| `FEATURES_1` | string | Enabled features, in order. | `environment.features.1` |\n" +
+		"| `TLS_KEY` | string ($base64) | Private key \\| PEM encoded. | `environment.tls_key` |\n" +
+		"| `APP_DEBUG` | boolean |  | `environment.app.debug` |\n"
+	assert.Equal(t, expected, buf.String())
+}
+
+func TestDocGen_WriteMarkdown_Escape(t *testing.T) {
+	const document = `{ environment: { "a|b": { c: "x" } } }`
+	d, err := docgen.Parse([]byte(document))
+	require.NoError(t, err)
+
+	data, err := jsonutil.Parse([]byte(document))
+	require.NoError(t, err)
+	list, err := jsonutil.FlattenKeyValues(data, "environment", jsonutil.Options{Names: jsonutil.NameAllow})
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, docgen.WriteMarkdown(&buf, d, list))
+	assert.Contains(t, buf.String(), "| `A\\|B_C` | string |  | `environment.a\\|b.c` |\n")
+}
+
+func TestDocGen_Schema(t *testing.T) {
+	d, err := docgen.Parse([]byte(testDocument))
+	require.NoError(t, err)
+
+	schema, err := json.Marshal(d.Schema([]string{"environment"}))
+	require.NoError(t, err)
+
+	expected := `{
+		"$schema": "http://json-schema.org/draft-07/schema#",
+		"description": "Application settings.",
+		"type": "object",
+		"properties": {
+			"database_url": { "description": "Connection string for the primary database.", "type": "string" },
+			"port": { "description": "Port the server listens on.", "type": "integer" },
+			"features": {
+				"description": "Enabled features, in order.",
+				"type": "array",
+				"items": { "type": "string" }
+			},
+			"tls_key": { "description": "Private key | PEM encoded.", "type": "string" },
+			"app": {
+				"type": "object",
+				"properties": { "debug": { "type": "boolean" } },
+				"required": ["debug"]
+			}
+		},
+		"required": ["database_url", "port", "features", "tls_key", "app"]
+	}`
+	assert.JSONEq(t, expected, string(schema))
+}
@@ -0,0 +1,802 @@
+// Package jsonschema validates parsed documents against a JSON Schema. Only a subset of JSON Schema draft 7 and later
+// is supported, made up of the following validation keywords:
+//
+//   - type, enum, const
+//   - properties, patternProperties, additionalProperties, required, propertyNames, minProperties, maxProperties
+//   - items (a single schema), minItems, maxItems
+//   - pattern, minLength, maxLength
+//   - minimum, maximum, exclusiveMinimum, exclusiveMaximum
+//   - allOf, anyOf, oneOf, not
+//   - $ref, for references within the schema (e.g. `#/definitions/port` or `#/$defs/port`)
+//
+// The annotation keywords $schema, $id, $comment, title, description, default, examples, readOnly, writeOnly,
+// deprecated and format, and the definitions and $defs containers, are accepted but have no effect on validation. A
+// schema that uses any other keyword (e.g. if, dependencies or uniqueItems) is rejected rather than partially applied.
+package jsonschema
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/hjson/hjson-go/v4"
+
+	"github.com/markeissler/injector/pkg/jsonutil"
+)
+
+// Schema is a compiled JSON Schema.
+type Schema struct {
+	always *bool
+	ref    *Schema
+
+	types    []string
+	enum     []interface{}
+	constant interface{}
+	hasConst bool
+
+	properties           map[string]*Schema
+	patternProperties    []patternSchema
+	additionalProperties *Schema
+	required             []string
+	propertyNames        *Schema
+	minProperties        *int
+	maxProperties        *int
+
+	items    *Schema
+	minItems *int
+	maxItems *int
+
+	pattern   *regexp.Regexp
+	minLength *int
+	maxLength *int
+
+	minimum          *float64
+	maximum          *float64
+	exclusiveMinimum *float64
+	exclusiveMaximum *float64
+
+	allOf []*Schema
+	anyOf []*Schema
+	oneOf []*Schema
+	not   *Schema
+}
+
+// patternSchema is the schema for properties whose name matches a regular expression.
+type patternSchema struct {
+	pattern *regexp.Regexp
+	schema  *Schema
+}
+
+// ValidationError describes a value, found at Path, that doesn't match a schema.
+type ValidationError struct {
+	Path    string
+	Message string
+}
+
+// Error returns the path of the value followed by the reason it doesn't match the schema.
+func (e ValidationError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Path, e.Message)
+}
+
+// ValidationErrors describes all of the values within a document that don't match a schema.
+type ValidationErrors []ValidationError
+
+// Error returns each of the validation errors separated by semicolons.
+func (e ValidationErrors) Error() string {
+	messages := make([]string, 0, len(e))
+	for _, err := range e {
+		messages = append(messages, err.Error())
+	}
+
+	return strings.Join(messages, "; ")
+}
+
+// Parse returns the schema described by JSON or HJSON content (see jsonutil.Parse).
+func Parse(data []byte) (*Schema, error) {
+	value, err := jsonutil.Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse schema: %v", err)
+	}
+
+	return Compile(value)
+}
+
+// Compile returns the schema described by a data tree (e.g. as returned by jsonutil.Parse).
+func Compile(value interface{}) (*Schema, error) {
+	c := compiler{root: value, refs: make(map[string]*Schema)}
+
+	return c.compile(value, "#")
+}
+
+// compiler compiles the schemas within a root schema, resolving references.
+type compiler struct {
+	root interface{}
+	refs map[string]*Schema
+}
+
+// compile returns the schema described by value, found at location within the root schema.
+func (c *compiler) compile(value interface{}, location string) (*Schema, error) {
+	s := &Schema{}
+	if err := c.compileInto(s, value, location); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// keywords are the schema keywords that are supported, including annotations that have no effect on validation.
+var keywords = map[string]bool{
+	"type": true, "enum": true, "const": true,
+	"properties": true, "patternProperties": true, "additionalProperties": true, "required": true,
+	"propertyNames": true, "minProperties": true, "maxProperties": true,
+	"items": true, "minItems": true, "maxItems": true,
+	"pattern": true, "minLength": true, "maxLength": true,
+	"minimum": true, "maximum": true, "exclusiveMinimum": true, "exclusiveMaximum": true,
+	"allOf": true, "anyOf": true, "oneOf": true, "not": true,
+	"$ref": true, "definitions": true, "$defs": true,
+	"$schema": true, "$id": true, "$comment": true, "title": true, "description": true, "default": true,
+	"examples": true, "readOnly": true, "writeOnly": true, "deprecated": true, "format": true,
+}
+
+// compileInto compiles the schema described by value into s.
+func (c *compiler) compileInto(s *Schema, value interface{}, location string) error {
+	switch v := value.(type) {
+	case bool:
+		s.always = &v
+		return nil
+	case *hjson.OrderedMap:
+		for _, key := range v.Keys {
+			if !keywords[key] {
+				return fmt.Errorf("invalid schema: %s: unsupported keyword: %s", location, key)
+			}
+		}
+		for _, compile := range []func(*Schema, *hjson.OrderedMap, string) error{
+			c.compileRef, c.compileGeneric, c.compileObject, c.compileArray, c.compileString, c.compileNumber,
+			c.compileCombinators,
+		} {
+			if err := compile(s, v, location); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	return fmt.Errorf("invalid schema: %s: schema must be an object or a boolean", location)
+}
+
+// compileRef compiles the $ref keyword. References are compiled once so that recursive schemas are supported.
+func (c *compiler) compileRef(s *Schema, object *hjson.OrderedMap, location string) error {
+	value, ok := object.Map["$ref"]
+	if !ok {
+		return nil
+	}
+
+	ref, ok := value.(string)
+	if !ok {
+		return fmt.Errorf("invalid schema: %s: $ref must be a string", location)
+	}
+
+	if target, ok := c.refs[ref]; ok {
+		s.ref = target
+		return nil
+	}
+
+	resolved, err := c.resolve(ref)
+	if err != nil {
+		return fmt.Errorf("invalid schema: %s: %v", location, err)
+	}
+
+	s.ref = &Schema{}
+	c.refs[ref] = s.ref
+
+	return c.compileInto(s.ref, resolved, ref)
+}
+
+// resolve returns the schema identified by a JSON pointer fragment (e.g. `#/definitions/port`) within the root schema.
+func (c *compiler) resolve(ref string) (interface{}, error) {
+	if ref != "#" && !strings.HasPrefix(ref, "#/") {
+		return nil, fmt.Errorf("unsupported $ref: %s", ref)
+	}
+
+	value := c.root
+	for _, token := range strings.Split(ref, "/")[1:] {
+		token = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+
+		switch v := value.(type) {
+		case *hjson.OrderedMap:
+			var ok bool
+			if value, ok = v.Map[token]; !ok {
+				return nil, fmt.Errorf("$ref not found: %s", ref)
+			}
+		case []interface{}:
+			i, err := strconv.Atoi(token)
+			if err != nil || i < 0 || i >= len(v) {
+				return nil, fmt.Errorf("$ref not found: %s", ref)
+			}
+			value = v[i]
+		default:
+			return nil, fmt.Errorf("$ref not found: %s", ref)
+		}
+	}
+
+	return value, nil
+}
+
+// compileGeneric compiles the keywords that apply to any type of value.
+func (c *compiler) compileGeneric(s *Schema, object *hjson.OrderedMap, location string) error {
+	switch v := object.Map["type"].(type) {
+	case nil:
+	case string:
+		s.types = []string{v}
+	case []interface{}:
+		for _, item := range v {
+			name, ok := item.(string)
+			if !ok {
+				return fmt.Errorf("invalid schema: %s: type must be a string or an array of strings", location)
+			}
+			s.types = append(s.types, name)
+		}
+	default:
+		return fmt.Errorf("invalid schema: %s: type must be a string or an array of strings", location)
+	}
+
+	for _, name := range s.types {
+		switch name {
+		case "null", "boolean", "object", "array", "number", "integer", "string":
+		default:
+			return fmt.Errorf("invalid schema: %s: unsupported type: %s", location, name)
+		}
+	}
+
+	if value, ok := object.Map["enum"]; ok {
+		if s.enum, ok = value.([]interface{}); !ok {
+			return fmt.Errorf("invalid schema: %s: enum must be an array", location)
+		}
+	}
+
+	s.constant, s.hasConst = object.Map["const"]
+
+	return nil
+}
+
+// compileObject compiles the keywords that apply to objects.
+func (c *compiler) compileObject(s *Schema, object *hjson.OrderedMap, location string) error {
+	var err error
+
+	if value, ok := object.Map["properties"]; ok {
+		properties, ok := value.(*hjson.OrderedMap)
+		if !ok {
+			return fmt.Errorf("invalid schema: %s: properties must be an object", location)
+		}
+		s.properties = make(map[string]*Schema, properties.Len())
+		for _, name := range properties.Keys {
+			if s.properties[name], err = c.compile(properties.Map[name], pointer(location, "properties", name)); err != nil {
+				return err
+			}
+		}
+	}
+
+	if value, ok := object.Map["patternProperties"]; ok {
+		properties, ok := value.(*hjson.OrderedMap)
+		if !ok {
+			return fmt.Errorf("invalid schema: %s: patternProperties must be an object", location)
+		}
+		for _, pattern := range properties.Keys {
+			p := patternSchema{}
+			if p.pattern, err = regexp.Compile(pattern); err != nil {
+				return fmt.Errorf("invalid schema: %s: invalid pattern: %s", location, pattern)
+			}
+			if p.schema, err = c.compile(properties.Map[pattern], pointer(location, "patternProperties", pattern)); err != nil {
+				return err
+			}
+			s.patternProperties = append(s.patternProperties, p)
+		}
+	}
+
+	if value, ok := object.Map["required"]; ok {
+		if s.required, err = stringList(value, location, "required"); err != nil {
+			return err
+		}
+	}
+
+	if s.additionalProperties, err = c.subschema(object, location, "additionalProperties"); err != nil {
+		return err
+	}
+	if s.propertyNames, err = c.subschema(object, location, "propertyNames"); err != nil {
+		return err
+	}
+	if s.minProperties, err = count(object, location, "minProperties"); err != nil {
+		return err
+	}
+	s.maxProperties, err = count(object, location, "maxProperties")
+
+	return err
+}
+
+// compileArray compiles the keywords that apply to arrays.
+func (c *compiler) compileArray(s *Schema, object *hjson.OrderedMap, location string) error {
+	var err error
+
+	if s.items, err = c.subschema(object, location, "items"); err != nil {
+		return err
+	}
+	if s.minItems, err = count(object, location, "minItems"); err != nil {
+		return err
+	}
+	s.maxItems, err = count(object, location, "maxItems")
+
+	return err
+}
+
+// compileString compiles the keywords that apply to strings.
+func (c *compiler) compileString(s *Schema, object *hjson.OrderedMap, location string) error {
+	var err error
+
+	if value, ok := object.Map["pattern"]; ok {
+		pattern, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("invalid schema: %s: pattern must be a string", location)
+		}
+		if s.pattern, err = regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("invalid schema: %s: invalid pattern: %s", location, pattern)
+		}
+	}
+
+	if s.minLength, err = count(object, location, "minLength"); err != nil {
+		return err
+	}
+	s.maxLength, err = count(object, location, "maxLength")
+
+	return err
+}
+
+// compileNumber compiles the keywords that apply to numbers.
+func (c *compiler) compileNumber(s *Schema, object *hjson.OrderedMap, location string) error {
+	var err error
+
+	if s.minimum, err = number(object, location, "minimum"); err != nil {
+		return err
+	}
+	if s.maximum, err = number(object, location, "maximum"); err != nil {
+		return err
+	}
+	if s.exclusiveMinimum, err = number(object, location, "exclusiveMinimum"); err != nil {
+		return err
+	}
+	s.exclusiveMaximum, err = number(object, location, "exclusiveMaximum")
+
+	return err
+}
+
+// compileCombinators compiles the keywords that combine schemas.
+func (c *compiler) compileCombinators(s *Schema, object *hjson.OrderedMap, location string) error {
+	var err error
+
+	if s.allOf, err = c.subschemas(object, location, "allOf"); err != nil {
+		return err
+	}
+	if s.anyOf, err = c.subschemas(object, location, "anyOf"); err != nil {
+		return err
+	}
+	if s.oneOf, err = c.subschemas(object, location, "oneOf"); err != nil {
+		return err
+	}
+	s.not, err = c.subschema(object, location, "not")
+
+	return err
+}
+
+// subschema compiles the schema that is the value of the keyword, if specified.
+func (c *compiler) subschema(object *hjson.OrderedMap, location, keyword string) (*Schema, error) {
+	value, ok := object.Map[keyword]
+	if !ok {
+		return nil, nil
+	}
+
+	return c.compile(value, pointer(location, keyword))
+}
+
+// subschemas compiles the array of schemas that is the value of the keyword, if specified.
+func (c *compiler) subschemas(object *hjson.OrderedMap, location, keyword string) ([]*Schema, error) {
+	value, ok := object.Map[keyword]
+	if !ok {
+		return nil, nil
+	}
+
+	list, ok := value.([]interface{})
+	if !ok || len(list) == 0 {
+		return nil, fmt.Errorf("invalid schema: %s: %s must be a non-empty array", location, keyword)
+	}
+
+	schemas := make([]*Schema, 0, len(list))
+	for i, item := range list {
+		s, err := c.compile(item, pointer(location, keyword, strconv.Itoa(i)))
+		if err != nil {
+			return nil, err
+		}
+		schemas = append(schemas, s)
+	}
+
+	return schemas, nil
+}
+
+// stringList returns the array of strings that is the value of the keyword.
+func stringList(value interface{}, location, keyword string) ([]string, error) {
+	list, ok := value.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("invalid schema: %s: %s must be an array of strings", location, keyword)
+	}
+
+	names := make([]string, 0, len(list))
+	for _, item := range list {
+		name, ok := item.(string)
+		if !ok {
+			return nil, fmt.Errorf("invalid schema: %s: %s must be an array of strings", location, keyword)
+		}
+		names = append(names, name)
+	}
+
+	return names, nil
+}
+
+// count returns the non-negative integer that is the value of the keyword, if specified.
+func count(object *hjson.OrderedMap, location, keyword string) (*int, error) {
+	value, ok := object.Map[keyword]
+	if !ok {
+		return nil, nil
+	}
+
+	f, ok := toFloat(value)
+	if !ok || f < 0 || f > math.MaxInt32 || f != math.Trunc(f) {
+		return nil, fmt.Errorf("invalid schema: %s: %s must be a non-negative integer", location, keyword)
+	}
+	n := int(f)
+
+	return &n, nil
+}
+
+// number returns the number that is the value of the keyword, if specified.
+func number(object *hjson.OrderedMap, location, keyword string) (*float64, error) {
+	value, ok := object.Map[keyword]
+	if !ok {
+		return nil, nil
+	}
+
+	f, ok := toFloat(value)
+	if !ok {
+		return nil, fmt.Errorf("invalid schema: %s: %s must be a number", location, keyword)
+	}
+
+	return &f, nil
+}
+
+// pointer returns the JSON pointer to a location within a schema.
+func pointer(location string, tokens ...string) string {
+	escaper := strings.NewReplacer("~", "~0", "/", "~1")
+	for _, token := range tokens {
+		location += "/" + escaper.Replace(token)
+	}
+
+	return location
+}
+
+// toFloat returns the value of a number.
+func toFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	case float64:
+		return v, true
+	case int:
+		return float64(v), true
+	}
+
+	return 0, false
+}
+
+// Validate returns the errors found validating the value, found at path within a document (see jsonutil.JoinPath),
+// against the schema. The result is empty if the value matches the schema. Value directives (see jsonutil.IsDirective)
+// are validated as strings whose contents aren't known, so only the type of a directive is checked.
+func (s *Schema) Validate(value interface{}, path string) ValidationErrors {
+	errs := make(ValidationErrors, 0)
+
+	if s.always != nil {
+		if !*s.always {
+			errs = append(errs, ValidationError{Path: path, Message: "is not allowed"})
+		}
+		return errs
+	}
+
+	if s.ref != nil {
+		errs = append(errs, s.ref.Validate(value, path)...)
+	}
+
+	errs = append(errs, s.validateGeneric(value, path)...)
+
+	switch v := value.(type) {
+	case *hjson.OrderedMap:
+		if !jsonutil.IsDirective(v) {
+			errs = append(errs, s.validateObject(v, path)...)
+		}
+	case []interface{}:
+		errs = append(errs, s.validateArray(v, path)...)
+	case string:
+		errs = append(errs, s.validateString(v, path)...)
+	case json.Number, float64, int:
+		f, _ := toFloat(v)
+		errs = append(errs, s.validateNumber(f, path)...)
+	}
+
+	return append(errs, s.validateCombinators(value, path)...)
+}
+
+// validateGeneric validates the keywords that apply to any type of value.
+func (s *Schema) validateGeneric(value interface{}, path string) ValidationErrors {
+	errs := make(ValidationErrors, 0)
+
+	if len(s.types) > 0 {
+		matched := false
+		for _, name := range s.types {
+			matched = matched || isType(value, name)
+		}
+		if !matched {
+			message := fmt.Sprintf("must be of type %s (got %s)", strings.Join(s.types, " or "), typeOf(value))
+			errs = append(errs, ValidationError{Path: path, Message: message})
+		}
+	}
+
+	// The contents of value directives aren't known so they can't be compared.
+	if jsonutil.IsDirective(value) {
+		return errs
+	}
+
+	if s.enum != nil {
+		matched := false
+		for _, item := range s.enum {
+			matched = matched || equal(value, item)
+		}
+		if !matched {
+			values := make([]string, 0, len(s.enum))
+			for _, item := range s.enum {
+				values = append(values, literal(item))
+			}
+			errs = append(errs, ValidationError{Path: path, Message: "must be one of " + strings.Join(values, ", ")})
+		}
+	}
+
+	if s.hasConst && !equal(value, s.constant) {
+		errs = append(errs, ValidationError{Path: path, Message: "must be " + literal(s.constant)})
+	}
+
+	return errs
+}
+
+// validateObject validates the keywords that apply to objects.
+func (s *Schema) validateObject(object *hjson.OrderedMap, path string) ValidationErrors {
+	errs := make(ValidationErrors, 0)
+
+	for _, name := range s.required {
+		if _, ok := object.Map[name]; !ok {
+			errs = append(errs, ValidationError{Path: path, Message: "missing required property: " + name})
+		}
+	}
+
+	if s.minProperties != nil && object.Len() < *s.minProperties {
+		errs = append(errs, ValidationError{Path: path, Message: fmt.Sprintf("must have at least %d properties", *s.minProperties)})
+	}
+	if s.maxProperties != nil && object.Len() > *s.maxProperties {
+		errs = append(errs, ValidationError{Path: path, Message: fmt.Sprintf("must have at most %d properties", *s.maxProperties)})
+	}
+
+	for _, name := range object.Keys {
+		propertyPath := jsonutil.JoinPath(path, name)
+		value := object.Map[name]
+
+		if s.propertyNames != nil {
+			for _, err := range s.propertyNames.Validate(name, propertyPath) {
+				err.Message = "property name " + err.Message
+				errs = append(errs, err)
+			}
+		}
+
+		matched := false
+		if property, ok := s.properties[name]; ok {
+			errs = append(errs, property.Validate(value, propertyPath)...)
+			matched = true
+		}
+		for _, p := range s.patternProperties {
+			if p.pattern.MatchString(name) {
+				errs = append(errs, p.schema.Validate(value, propertyPath)...)
+				matched = true
+			}
+		}
+		if !matched && s.additionalProperties != nil {
+			errs = append(errs, s.additionalProperties.Validate(value, propertyPath)...)
+		}
+	}
+
+	return errs
+}
+
+// validateArray validates the keywords that apply to arrays.
+func (s *Schema) validateArray(list []interface{}, path string) ValidationErrors {
+	errs := make(ValidationErrors, 0)
+
+	if s.minItems != nil && len(list) < *s.minItems {
+		errs = append(errs, ValidationError{Path: path, Message: fmt.Sprintf("must have at least %d items", *s.minItems)})
+	}
+	if s.maxItems != nil && len(list) > *s.maxItems {
+		errs = append(errs, ValidationError{Path: path, Message: fmt.Sprintf("must have at most %d items", *s.maxItems)})
+	}
+
+	if s.items != nil {
+		for i, item := range list {
+			errs = append(errs, s.items.Validate(item, jsonutil.JoinPath(path, strconv.Itoa(i)))...)
+		}
+	}
+
+	return errs
+}
+
+// validateString validates the keywords that apply to strings.
+func (s *Schema) validateString(value, path string) ValidationErrors {
+	errs := make(ValidationErrors, 0)
+
+	if s.pattern != nil && !s.pattern.MatchString(value) {
+		errs = append(errs, ValidationError{Path: path, Message: "must match pattern " + s.pattern.String()})
+	}
+
+	length := utf8.RuneCountInString(value)
+	if s.minLength != nil && length < *s.minLength {
+		errs = append(errs, ValidationError{Path: path, Message: fmt.Sprintf("must be at least %d characters long", *s.minLength)})
+	}
+	if s.maxLength != nil && length > *s.maxLength {
+		errs = append(errs, ValidationError{Path: path, Message: fmt.Sprintf("must be at most %d characters long", *s.maxLength)})
+	}
+
+	return errs
+}
+
+// validateNumber validates the keywords that apply to numbers.
+func (s *Schema) validateNumber(value float64, path string) ValidationErrors {
+	errs := make(ValidationErrors, 0)
+
+	format := func(f float64) string { return strconv.FormatFloat(f, 'f', -1, 64) }
+
+	if s.minimum != nil && value < *s.minimum {
+		errs = append(errs, ValidationError{Path: path, Message: "must be >= " + format(*s.minimum)})
+	}
+	if s.maximum != nil && value > *s.maximum {
+		errs = append(errs, ValidationError{Path: path, Message: "must be <= " + format(*s.maximum)})
+	}
+	if s.exclusiveMinimum != nil && value <= *s.exclusiveMinimum {
+		errs = append(errs, ValidationError{Path: path, Message: "must be > " + format(*s.exclusiveMinimum)})
+	}
+	if s.exclusiveMaximum != nil && value >= *s.exclusiveMaximum {
+		errs = append(errs, ValidationError{Path: path, Message: "must be < " + format(*s.exclusiveMaximum)})
+	}
+
+	return errs
+}
+
+// validateCombinators validates the keywords that combine schemas.
+func (s *Schema) validateCombinators(value interface{}, path string) ValidationErrors {
+	errs := make(ValidationErrors, 0)
+
+	for _, schema := range s.allOf {
+		errs = append(errs, schema.Validate(value, path)...)
+	}
+
+	if len(s.anyOf) > 0 && s.matches(s.anyOf, value, path) == 0 {
+		errs = append(errs, ValidationError{Path: path, Message: "must match at least one of the anyOf schemas"})
+	}
+
+	if len(s.oneOf) > 0 {
+		if matched := s.matches(s.oneOf, value, path); matched != 1 {
+			message := fmt.Sprintf("must match exactly one of the oneOf schemas (matched %d)", matched)
+			errs = append(errs, ValidationError{Path: path, Message: message})
+		}
+	}
+
+	if s.not != nil && len(s.not.Validate(value, path)) == 0 {
+		errs = append(errs, ValidationError{Path: path, Message: "must not match the not schema"})
+	}
+
+	return errs
+}
+
+// matches returns the number of schemas the value matches.
+func (s *Schema) matches(schemas []*Schema, value interface{}, path string) int {
+	matched := 0
+	for _, schema := range schemas {
+		if len(schema.Validate(value, path)) == 0 {
+			matched++
+		}
+	}
+
+	return matched
+}
+
+// typeOf returns the JSON Schema type name of a value. Value directives are strings.
+func typeOf(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case *hjson.OrderedMap:
+		if jsonutil.IsDirective(v) {
+			return "string"
+		}
+		return "object"
+	}
+
+	if f, ok := toFloat(value); ok && !math.IsInf(f, 0) && f == math.Trunc(f) {
+		return "integer"
+	}
+
+	return "number"
+}
+
+// isType returns true if the value is of the named JSON Schema type. Integers are also numbers.
+func isType(value interface{}, name string) bool {
+	actual := typeOf(value)
+
+	return actual == name || (name == "number" && actual == "integer")
+}
+
+// equal returns true if two data tree values are equal. Numbers are compared by value and object properties in any
+// order.
+func equal(a, b interface{}) bool {
+	if fa, ok := toFloat(a); ok {
+		fb, ok := toFloat(b)
+		return ok && fa == fb
+	}
+
+	switch va := a.(type) {
+	case []interface{}:
+		vb, ok := b.([]interface{})
+		if !ok || len(va) != len(vb) {
+			return false
+		}
+		for i := range va {
+			if !equal(va[i], vb[i]) {
+				return false
+			}
+		}
+		return true
+	case *hjson.OrderedMap:
+		vb, ok := b.(*hjson.OrderedMap)
+		if !ok || va.Len() != vb.Len() {
+			return false
+		}
+		for _, key := range va.Keys {
+			value, ok := vb.Map[key]
+			if !ok || !equal(va.Map[key], value) {
+				return false
+			}
+		}
+		return true
+	}
+
+	return a == b
+}
+
+// literal returns the JSON representation of a value for use in messages.
+func literal(value interface{}) string {
+	b, err := jsonutil.Marshal(value)
+	if err != nil {
+		return fmt.Sprintf("%v", value)
+	}
+
+	return string(b)
+}
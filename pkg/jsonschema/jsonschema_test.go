@@ -0,0 +1,137 @@
+package jsonschema_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/markeissler/injector/pkg/jsonschema"
+	"github.com/markeissler/injector/pkg/jsonutil"
+)
+
+const testSchema = `{
+	type: "object"
+	required: ["database_url", "port"]
+	properties: {
+		database_url: { type: "string", pattern: "^postgres://" }
+		port: { $ref: "#/definitions/port" }
+		log_level: { enum: ["debug", "info", "warn"] }
+		tls_key: { type: "string", minLength: 8 }
+		features: { type: "array", items: { type: "boolean" }, maxItems: 2 }
+	}
+	patternProperties: {
+		"^new_relic_": { type: "string" }
+	}
+	additionalProperties: false
+	definitions: {
+		port: { type: "integer", minimum: 1, maximum: 65535 }
+	}
+}`
+
+func TestJSONSchema_Validate(t *testing.T) {
+	schema, err := jsonschema.Parse([]byte(testSchema))
+	require.NoError(t, err)
+
+	data, err := jsonutil.Parse([]byte(`{
+		environment: {
+			database_url: "postgres://db.example.com/app"
+			port: 5432
+			log_level: "info"
+			tls_key: { $base64: "a2V5" }
+			features: [true, false]
+			new_relic_license_key: "abc"
+		}
+	}`))
+	require.NoError(t, err)
+
+	environment, _ := jsonutil.Get(data, "environment")
+	assert.Empty(t, schema.Validate(environment, "environment"))
+}
+
+func TestJSONSchema_Validate_Errors(t *testing.T) {
+	schema, err := jsonschema.Parse([]byte(testSchema))
+	require.NoError(t, err)
+
+	data, err := jsonutil.Parse([]byte(`{
+		environment: {
+			database_url: "mysql://db.example.com/app"
+			log_level: "trace"
+			tls_key: "short"
+			features: [true, "no", false]
+			new_relic_license_key: 1
+			debug: true
+		}
+	}`))
+	require.NoError(t, err)
+
+	environment, _ := jsonutil.Get(data, "environment")
+	errs := schema.Validate(environment, "environment")
+
+	expected := jsonschema.ValidationErrors{
+		{Path: "environment", Message: "missing required property: port"},
+		{Path: "environment.database_url", Message: "must match pattern ^postgres://"},
+		{Path: "environment.log_level", Message: `must be one of "debug", "info", "warn"`},
+		{Path: "environment.tls_key", Message: "must be at least 8 characters long"},
+		{Path: "environment.features", Message: "must have at most 2 items"},
+		{Path: "environment.features.1", Message: "must be of type boolean (got string)"},
+		{Path: "environment.new_relic_license_key", Message: "must be of type string (got integer)"},
+		{Path: "environment.debug", Message: "is not allowed"},
+	}
+	assert.Equal(t, expected, errs)
+}
+
+func TestJSONSchema_Validate_Combinators(t *testing.T) {
+	schema, err := jsonschema.Parse([]byte(`{
+		additionalProperties: {
+			anyOf: [{ type: "string" }, { type: "number", exclusiveMinimum: 0 }]
+			not: { const: "changeme" }
+		}
+		propertyNames: { pattern: "^[a-z_]+$" }
+	}`))
+	require.NoError(t, err)
+
+	data, err := jsonutil.Parse([]byte(`{ token: "changeme", timeout: 0, Retries: 3, ratio: 0.5 }`))
+	require.NoError(t, err)
+
+	expected := jsonschema.ValidationErrors{
+		{Path: "token", Message: "must not match the not schema"},
+		{Path: "timeout", Message: "must match at least one of the anyOf schemas"},
+		{Path: "Retries", Message: "property name must match pattern ^[a-z_]+$"},
+	}
+	assert.Equal(t, expected, schema.Validate(data, ""))
+}
+
+func TestJSONSchema_Validate_LargeNumbers(t *testing.T) {
+	schema, err := jsonschema.Parse([]byte(`{ additionalProperties: { type: "integer" } }`))
+	require.NoError(t, err)
+
+	data, err := jsonutil.Parse([]byte(`{ a: 1e20, b: -18446744073709551616, c: 1.5, d: 1e400 }`))
+	require.NoError(t, err)
+
+	errs := schema.Validate(data, "")
+	require.Len(t, errs, 2)
+	assert.Equal(t, []string{"c", "d"}, []string{errs[0].Path, errs[1].Path})
+}
+
+func TestJSONSchema_Parse_Errors(t *testing.T) {
+	tests := []struct {
+		schema   string
+		expected string
+	}{
+		{`{ type: "text" }`, "invalid schema: #: unsupported type: text"},
+		{`{ properties: { a: { minLength: -1 } } }`, "invalid schema: #/properties/a: minLength must be a non-negative integer"},
+		{`{ pattern: "(" }`, "invalid schema: #: invalid pattern: ("},
+		{`{ $ref: "#/definitions/missing" }`, "invalid schema: #: $ref not found: #/definitions/missing"},
+		{`{ $ref: "other.json" }`, "invalid schema: #: unsupported $ref: other.json"},
+		{`{ anyOf: [] }`, "invalid schema: #: anyOf must be a non-empty array"},
+		{`{ maxLength: 1e20 }`, "invalid schema: #: maxLength must be a non-negative integer"},
+		{`{ type: "array", uniqueItems: true }`, "invalid schema: #: unsupported keyword: uniqueItems"},
+		{`{ properties: { a: { if: { const: 1 } } } }`, "invalid schema: #/properties/a: unsupported keyword: if"},
+	}
+
+	for _, test := range tests {
+		_, err := jsonschema.Parse([]byte(test.schema))
+		assert.EqualError(t, err, test.expected, test.schema)
+	}
+}
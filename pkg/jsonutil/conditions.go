@@ -0,0 +1,124 @@
+package jsonutil
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+
+	"github.com/hjson/hjson-go/v4"
+)
+
+const (
+	// WhenKey is the top-level document property listing conditional blocks.
+	WhenKey = "when"
+	// ConditionKey is the conditional block property listing the conditions that select the block.
+	ConditionKey = "if"
+)
+
+// ApplyConditions returns the document that results from merging each of the conditional blocks listed by the `when`
+// property of data, whose conditions all match the selectors, over the rest of the document in order (see Merge). For
+// example:
+//
+// ```json
+// {
+//     "environment": { "log_level": "debug" },
+//     "when": [
+//         { "if": { "env": "prod", "hostname": "web-*" }, "environment": { "log_level": "warn" } }
+//     ]
+// }
+// ```
+//
+// Each condition maps a selector name to a glob pattern (see path.Match), or an array of patterns any of which may
+// match. A condition for a selector that isn't set doesn't match. The `when` property is removed from the result and
+// the indexes of the blocks that were applied are returned.
+func ApplyConditions(data *hjson.OrderedMap, selectors map[string]string) (*hjson.OrderedMap, []int, error) {
+	applied := make([]int, 0)
+
+	value, ok := data.Map[WhenKey]
+	if !ok {
+		return data, applied, nil
+	}
+
+	blocks, ok := value.([]interface{})
+	if !ok {
+		return data, applied, fmt.Errorf("%s must be an array", WhenKey)
+	}
+
+	merged := hjson.NewOrderedMap()
+	for _, key := range data.Keys {
+		if key != WhenKey {
+			merged.Set(key, data.Map[key])
+		}
+	}
+
+	for i, value := range blocks {
+		blockPath := JoinPath(WhenKey, strconv.Itoa(i))
+
+		block, ok := value.(*hjson.OrderedMap)
+		if !ok {
+			return data, applied, fmt.Errorf("conditional block must be an object: %s", blockPath)
+		}
+
+		matched, err := _matchConditions(block.Map[ConditionKey], JoinPath(blockPath, ConditionKey), selectors)
+		if err != nil {
+			return data, applied, err
+		}
+		if !matched {
+			continue
+		}
+
+		overrides := hjson.NewOrderedMap()
+		for _, key := range block.Keys {
+			if key != ConditionKey {
+				overrides.Set(key, block.Map[key])
+			}
+		}
+		merged = Merge(merged, overrides)
+		applied = append(applied, i)
+	}
+
+	return merged, applied, nil
+}
+
+// _matchConditions returns true if all of the conditions match the selectors.
+func _matchConditions(value interface{}, conditionsPath string, selectors map[string]string) (bool, error) {
+	conditions, ok := value.(*hjson.OrderedMap)
+	if !ok {
+		return false, fmt.Errorf("conditional block requires an object of conditions: %s", conditionsPath)
+	}
+
+	matched := true
+	for _, name := range conditions.Keys {
+		conditionPath := JoinPath(conditionsPath, name)
+
+		var patterns []string
+		switch v := conditions.Map[name].(type) {
+		case string:
+			patterns = []string{v}
+		case []interface{}:
+			for _, item := range v {
+				pattern, ok := item.(string)
+				if !ok {
+					return false, fmt.Errorf("condition must be a string or an array of strings: %s", conditionPath)
+				}
+				patterns = append(patterns, pattern)
+			}
+		default:
+			return false, fmt.Errorf("condition must be a string or an array of strings: %s", conditionPath)
+		}
+
+		// Patterns are validated even if the selector isn't set so that errors don't depend on the selectors.
+		selector, isSet := selectors[name]
+		found := false
+		for _, pattern := range patterns {
+			ok, err := path.Match(pattern, selector)
+			if err != nil {
+				return false, fmt.Errorf("invalid condition pattern: %s (%s)", pattern, conditionPath)
+			}
+			found = found || (isSet && ok)
+		}
+		matched = matched && found
+	}
+
+	return matched, nil
+}
@@ -0,0 +1,102 @@
+package jsonutil
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"unicode"
+
+	"github.com/hjson/hjson-go/v4"
+)
+
+// Value directives are objects with a single property that identifies how the value of that property is decoded when
+// flattened, instead of being flattened as a nested object. For example:
+//
+// ```json
+// {
+//     "tls_key": { "$base64": "LS0tLS1CRUdJTi..." },
+//     "hostname": { "$env": "HOSTNAME" }
+// }
+// ```
+const (
+	// DirectiveBase64 decodes a standard base64 encoded value. Whitespace within the encoded value is ignored.
+	DirectiveBase64 = "$base64"
+	// DirectiveHex decodes a hexadecimal encoded value. Whitespace within the encoded value is ignored.
+	DirectiveHex = "$hex"
+	// DirectiveFile reads the value from the named file. The contents are used exactly as stored in the file.
+	DirectiveFile = "$file"
+	// DirectiveEnv reads the value from the named environment variable of the parent process.
+	DirectiveEnv = "$env"
+)
+
+// IsDirective returns true if the value is a value directive, that is, an object with a single property whose name
+// begins with `$`.
+func IsDirective(value interface{}) bool {
+	object, ok := value.(*hjson.OrderedMap)
+	return ok && object.Len() == 1 && strings.HasPrefix(object.Keys[0], "$")
+}
+
+// DecodeDirective returns the decoded value of a value directive found at path. The second return value is false if the
+// value isn't a value directive (see IsDirective).
+func DecodeDirective(value interface{}, path string, options Options) (string, bool, error) {
+	if !IsDirective(value) {
+		return "", false, nil
+	}
+
+	object := value.(*hjson.OrderedMap)
+	name := object.Keys[0]
+	argument, ok := object.Map[name].(string)
+	if !ok {
+		return "", true, fmt.Errorf("value directive %s requires a string: %s", name, path)
+	}
+
+	var decoded []byte
+	var err error
+
+	switch name {
+	case DirectiveBase64:
+		decoded, err = base64.StdEncoding.DecodeString(_withoutSpace(argument))
+	case DirectiveHex:
+		decoded, err = hex.DecodeString(_withoutSpace(argument))
+	case DirectiveFile:
+		readFile := options.ReadFile
+		if readFile == nil {
+			readFile = ioutil.ReadFile
+		}
+		decoded, err = readFile(argument)
+	case DirectiveEnv:
+		lookupEnv := options.LookupEnv
+		if lookupEnv == nil {
+			lookupEnv = os.LookupEnv
+		}
+		s, found := lookupEnv(argument)
+		if !found {
+			return "", true, fmt.Errorf("environment variable not set: %s (from %s)", argument, path)
+		}
+		decoded = []byte(s)
+	default:
+		return "", true, fmt.Errorf("unsupported value directive: %s (%s)", name, path)
+	}
+
+	if err != nil {
+		return "", true, fmt.Errorf("failed to decode %s value (%s): %v", name, path, err)
+	}
+	if strings.ContainsRune(string(decoded), 0) {
+		return "", true, fmt.Errorf("decoded %s value contains a NUL character (%s)", name, path)
+	}
+
+	return string(decoded), true, nil
+}
+
+// _withoutSpace returns s with all whitespace removed.
+func _withoutSpace(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return -1
+		}
+		return r
+	}, s)
+}
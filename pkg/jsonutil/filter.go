@@ -0,0 +1,74 @@
+package jsonutil
+
+import (
+	"fmt"
+	"path"
+)
+
+// Filter selects flattened key/value pairs with glob patterns (see path.Match) matched against either the key name
+// (e.g. `NEW_RELIC_*`) or the document path (e.g. `environment.new_relic.*`). When Only is not empty only pairs that
+// match at least one of its patterns are kept; pairs that match any of the Exclude patterns are then removed.
+type Filter struct {
+	Only    []string
+	Exclude []string
+}
+
+// FilteredKeyValue is a key/value pair removed by a Filter along with the reason it was removed.
+type FilteredKeyValue struct {
+	KeyValue
+	Reason string
+}
+
+// IsEmpty returns true if the filter has no patterns, in which case all pairs are kept.
+func (f Filter) IsEmpty() bool {
+	return len(f.Only) == 0 && len(f.Exclude) == 0
+}
+
+// Validate returns an error if any of the filter patterns are malformed.
+func (f Filter) Validate() error {
+	for _, pattern := range append(append([]string{}, f.Only...), f.Exclude...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid filter pattern: %s", pattern)
+		}
+	}
+
+	return nil
+}
+
+// Apply returns the key/value pairs kept by the filter, in order, along with the pairs that were removed.
+func (f Filter) Apply(list []KeyValue) ([]KeyValue, []FilteredKeyValue) {
+	kept := make([]KeyValue, 0, len(list))
+	removed := make([]FilteredKeyValue, 0)
+
+	for _, kv := range list {
+		if len(f.Only) > 0 {
+			if _, ok := _matchKeyValue(kv, f.Only); !ok {
+				removed = append(removed, FilteredKeyValue{KeyValue: kv, Reason: "not matched by only patterns"})
+				continue
+			}
+		}
+
+		if pattern, ok := _matchKeyValue(kv, f.Exclude); ok {
+			removed = append(removed, FilteredKeyValue{KeyValue: kv, Reason: fmt.Sprintf("excluded by %s", pattern)})
+			continue
+		}
+
+		kept = append(kept, kv)
+	}
+
+	return kept, removed
+}
+
+// _matchKeyValue returns the first pattern that matches either the key name or the document path of the pair.
+func _matchKeyValue(kv KeyValue, patterns []string) (string, bool) {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, kv.Key); ok {
+			return pattern, true
+		}
+		if ok, _ := path.Match(pattern, kv.Path); ok {
+			return pattern, true
+		}
+	}
+
+	return "", false
+}
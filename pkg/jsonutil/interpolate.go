@@ -0,0 +1,224 @@
+package jsonutil
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hjson/hjson-go/v4"
+)
+
+// Interpolate resolves references of the form `${NAME}` within the values of flattened key/value pairs. A reference
+// identifies either a generated key name (e.g. `${DB_HOST}`) or a document path (e.g. `${environment.db.host}` or a
+// path outside of the flattened part of the document such as `${shared.hostname}`). When environment is not nil,
+// references that can't otherwise be resolved are looked up in it; this allows parent environment variables to be
+// referenced and should only be enabled explicitly.
+//
+// Other supported forms are:
+//
+// ```
+//	${NAME:-default}	the default (which may itself contain references) is used if NAME is unresolved or empty
+//	$$		a literal `$`
+// ```
+//
+// A `$` that isn't followed by `{` or `$` is left as is. A value that references its own key name or path is resolved
+// from the environment (or its default) rather than from itself. Values decoded from value directives aren't
+// interpolated. An error is returned for unresolved references without a default and for references that form a
+// cycle.
+func Interpolate(data interface{}, list []KeyValue, environment map[string]string, options Options) ([]KeyValue, error) {
+	r := &_resolver{
+		data:        data,
+		list:        list,
+		environment: environment,
+		options:     options,
+		byKey:       make(map[string]int, len(list)),
+		byPath:      make(map[string]int, len(list)),
+		resolved:    make(map[string]string),
+		resolving:   make(map[string]bool),
+	}
+	for i, kv := range list {
+		r.byKey[kv.Key] = i
+		r.byPath[kv.Path] = i
+	}
+
+	s := make([]KeyValue, 0, len(list))
+	for i, kv := range list {
+		if !kv.Unset {
+			value, _, err := r.resolveIndex(i)
+			if err != nil {
+				return []KeyValue{}, err
+			}
+			kv.Value = value
+		}
+		s = append(s, kv)
+	}
+
+	return s, nil
+}
+
+// _resolver holds the state of a single interpolation pass. Resolved values are cached by id and the ids being
+// resolved are tracked, in order, for cycle detection.
+type _resolver struct {
+	data        interface{}
+	list        []KeyValue
+	environment map[string]string
+	options     Options
+	byKey       map[string]int
+	byPath      map[string]int
+	resolved    map[string]string
+	resolving   map[string]bool
+	stack       []string
+}
+
+// resolveIndex returns the interpolated value of the key/value pair at index i of the list. The second return value
+// is false if the pair is to be unset.
+func (r *_resolver) resolveIndex(i int) (string, bool, error) {
+	kv := r.list[i]
+	if kv.Unset {
+		return "", false, nil
+	}
+	if kv.Literal {
+		return kv.Value, true, nil
+	}
+
+	value, err := r.resolve(kv.Key, kv.Value)
+	return value, true, err
+}
+
+// resolve returns the interpolated value identified by name, detecting cycles.
+func (r *_resolver) resolve(name, value string) (string, error) {
+	if resolved, ok := r.resolved[name]; ok {
+		return resolved, nil
+	}
+	if r.resolving[name] {
+		return "", fmt.Errorf("interpolation cycle: %s -> %s", strings.Join(r.stack, " -> "), name)
+	}
+
+	r.resolving[name] = true
+	r.stack = append(r.stack, name)
+	defer func() {
+		r.resolving[name] = false
+		r.stack = r.stack[:len(r.stack)-1]
+	}()
+
+	resolved, err := r.expand(value)
+	if err != nil {
+		return "", err
+	}
+	r.resolved[name] = resolved
+
+	return resolved, nil
+}
+
+// lookup returns the interpolated value of a reference. The second return value is false if the reference can't be
+// resolved.
+func (r *_resolver) lookup(name string) (string, bool, error) {
+	i, ok := r.byKey[name]
+	if !ok {
+		i, ok = r.byPath[name]
+	}
+
+	// A value that references its own name (e.g. `PATH: "${PATH}:/opt/bin"`) refers to the environment.
+	if ok && r.list[i].Key != r.stack[len(r.stack)-1] {
+		return r.resolveIndex(i)
+	}
+
+	if value, found := Get(r.data, name); !ok && found && value != nil {
+		if decoded, isDirective, err := DecodeDirective(value, name, r.options); isDirective {
+			return decoded, err == nil, err
+		}
+
+		switch value.(type) {
+		case *hjson.OrderedMap, []interface{}:
+			return "", false, fmt.Errorf("interpolation reference is not a scalar value: %s", name)
+		}
+		resolved, err := r.resolve(name, r.options.valueToString(value))
+		return resolved, true, err
+	}
+
+	if r.environment != nil {
+		if value, ok := r.environment[name]; ok {
+			return value, true, nil
+		}
+	}
+
+	return "", false, nil
+}
+
+// expand returns s with all references replaced by their values.
+func (r *_resolver) expand(s string) (string, error) {
+	var b strings.Builder
+
+	for i := 0; i < len(s); i++ {
+		if s[i] != '$' || i+1 == len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+
+		switch s[i+1] {
+		case '$':
+			b.WriteByte('$')
+			i++
+		case '{':
+			end := _closingBrace(s, i+2)
+			if end < 0 {
+				return "", fmt.Errorf("unterminated interpolation reference: %s", s[i:])
+			}
+			value, err := r.expandReference(s[i+2 : end])
+			if err != nil {
+				return "", err
+			}
+			b.WriteString(value)
+			i = end
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+
+	return b.String(), nil
+}
+
+// expandReference returns the value of the body of a `${...}` reference, applying its default if necessary.
+func (r *_resolver) expandReference(body string) (string, error) {
+	name, fallback, hasDefault := body, "", false
+	if i := strings.Index(body, ":-"); i >= 0 {
+		name, fallback, hasDefault = body[:i], body[i+2:], true
+	}
+
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", fmt.Errorf("empty interpolation reference: ${%s}", body)
+	}
+
+	value, ok, err := r.lookup(name)
+	if err != nil {
+		return "", err
+	}
+
+	switch {
+	case hasDefault && value == "":
+		return r.expand(fallback)
+	case !ok:
+		return "", fmt.Errorf("unresolved interpolation reference: ${%s} in %s", name, strings.Join(r.stack, " -> "))
+	}
+
+	return value, nil
+}
+
+// _closingBrace returns the index of the brace that closes a reference body beginning at start, accounting for nested
+// references, or -1 if the reference isn't terminated.
+func _closingBrace(s string, start int) int {
+	depth := 0
+	for i := start; i < len(s); i++ {
+		switch {
+		case s[i] == '$' && i+1 < len(s) && s[i+1] == '{':
+			depth++
+			i++
+		case s[i] == '}' && depth == 0:
+			return i
+		case s[i] == '}':
+			depth--
+		}
+	}
+
+	return -1
+}
@@ -2,12 +2,12 @@ package jsonutil
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
+	"strconv"
 	"strings"
 
-	"github.com/tidwall/gjson"
-
-	"github.com/markeissler/injector/pkg/stringutil"
+	"github.com/hjson/hjson-go/v4"
 )
 
 // ConvertUnicodeToASCII converts selected unicode characters to an ascii representation to support intended output.
@@ -28,9 +28,114 @@ func ConvertUnicodeToASCII(data []byte) []byte {
 	return data
 }
 
+// Parse parses JSON or HJSON data into an ordered object. Object keys retain the order in which they appear in the
+// data and numbers are represented as json.Number values so that their literal representation is preserved exactly
+// (e.g. large integer ids aren't converted to floating point). Values in the returned tree will be one of the
+// following types:
+//
+// ```go
+//	nil
+//	bool
+//	string
+//	json.Number
+//	[]interface{}
+//	*hjson.OrderedMap
+// ```
+//
+// Blank data is parsed as an empty object.
+func Parse(data []byte) (*hjson.OrderedMap, error) {
+	object := hjson.NewOrderedMap()
+	if len(bytes.TrimSpace(data)) == 0 {
+		return object, nil
+	}
+
+	options := hjson.DefaultDecoderOptions()
+	options.UseJSONNumber = true
+	if err := hjson.UnmarshalWithOptions(data, object, options); err != nil {
+		return object, err
+	}
+
+	return object, nil
+}
+
+// Get returns the value found at the path in the data tree. Path elements are separated by periods (a literal period
+// can be escaped with a backslash) and array elements are identified by their index, similar to gjson paths. For
+// example, `services.billing.hosts.0` identifies the first element of the `hosts` array in the `billing` object.
+func Get(data interface{}, path string) (interface{}, bool) {
+	if path == "" {
+		return data, true
+	}
+
+	value := data
+	for _, key := range splitPath(path) {
+		switch v := value.(type) {
+		case *hjson.OrderedMap:
+			var ok bool
+			if value, ok = v.Map[key]; !ok {
+				return nil, false
+			}
+		case []interface{}:
+			index, err := strconv.Atoi(key)
+			if err != nil || index < 0 || index >= len(v) {
+				return nil, false
+			}
+			value = v[index]
+		default:
+			return nil, false
+		}
+	}
+
+	return value, true
+}
+
+// Merge returns a new object with the properties of overlay merged over those of base. Objects that appear in both are
+// merged recursively; any other value in overlay replaces the value in base. Properties of base retain their order and
+// properties that only appear in overlay follow them in the order in which they appear in overlay. Neither base nor
+// overlay are modified.
+func Merge(base, overlay *hjson.OrderedMap) *hjson.OrderedMap {
+	merged := hjson.NewOrderedMap()
+
+	for _, key := range base.Keys {
+		merged.Set(key, base.Map[key])
+	}
+
+	for _, key := range overlay.Keys {
+		value := overlay.Map[key]
+		if baseObject, ok := merged.Map[key].(*hjson.OrderedMap); ok {
+			if overlayObject, ok := value.(*hjson.OrderedMap); ok {
+				value = Merge(baseObject, overlayObject)
+			}
+		}
+		merged.Set(key, value)
+	}
+
+	return merged
+}
+
+// splitPath splits a path into its elements on unescaped periods.
+func splitPath(path string) []string {
+	keys := make([]string, 0)
+
+	var key strings.Builder
+	for i := 0; i < len(path); i++ {
+		switch {
+		case path[i] == '\\' && i+1 < len(path):
+			i++
+			key.WriteByte(path[i])
+		case path[i] == '.':
+			keys = append(keys, key.String())
+			key.Reset()
+		default:
+			key.WriteByte(path[i])
+		}
+	}
+
+	return append(keys, key.String())
+}
+
 // Flatten parses JSON data into a flattened string array of key/value pairs formatted with the provided formatter
-// string. The path value determines which part of the object should be plucked for parsing. Flattened keys will consist
-// of uppercase characters only with path elements separated by underscores.
+// string. The path value determines which part of the object should be plucked for parsing. By default flattened keys
+// will consist of uppercase characters only with path elements separated by underscores (see Options).
 //
 // For example:
 // ```json
@@ -60,30 +165,344 @@ func ConvertUnicodeToASCII(data []byte) []byte {
 //		`SERVER_BASE_URL="https://institutional-api-staging.alphaflow.com/v1"`,
 // ]
 // ```
-func Flatten(jsonBytes []byte, path, formatter string) []string {
-	result := gjson.GetBytes(jsonBytes, path)
+//
+// Keys are returned in the order in which they appear in the data. Arrays are flattened as specified by the options and
+// variables to be unset are omitted.
+func Flatten(data interface{}, path, formatter string, options Options) ([]string, error) {
+	list, err := FlattenKeyValues(data, path, options)
+	if err != nil {
+		return []string{}, err
+	}
+
+	s := make([]string, 0, len(list))
+	for _, kv := range list {
+		if kv.Unset {
+			continue
+		}
+		s = append(s, fmt.Sprintf(formatter, kv.Key, kv.Value))
+	}
+
+	return s, nil
+}
+
+// KeyValue represents a single flattened key/value pair. When Unset is true the variable identified by Key should be
+// removed from the environment (see NullUnset) and Value is empty. Path identifies the value in the source data from
+// which the pair was flattened (see Get). When Literal is true Value was decoded from a value directive and won't be
+// interpolated (see Interpolate).
+type KeyValue struct {
+	Key     string
+	Value   string
+	Unset   bool
+	Path    string
+	Literal bool
+}
+
+// FlattenKeyValues parses JSON data into a flattened array of key/value pairs. The path value determines which part of
+// the object should be plucked for parsing.
+//
+// See: Flatten for examples.
+func FlattenKeyValues(data interface{}, path string, options Options) ([]KeyValue, error) {
+	return FlattenRoots(data, []string{path}, options)
+}
+
+// FlattenRoots parses JSON data into a flattened array of key/value pairs merged from each of the parts of the object
+// identified by paths, in order. Paths that aren't found in the data are skipped. Key names that appear under more than
+// one path are handled by the collision policy.
+//
+// See: Flatten for examples.
+func FlattenRoots(data interface{}, paths []string, options Options) ([]KeyValue, error) {
+	roots := make(map[string]interface{}, len(paths))
+	size := 0
+	for _, path := range paths {
+		if value, ok := Get(data, path); ok {
+			roots[path] = value
+			size += _countValues(value)
+		}
+	}
+
+	s := make([]KeyValue, 0, size)
+	for _, path := range paths {
+		value, ok := roots[path]
+		if !ok {
+			continue
+		}
+
+		var err error
+		if s, err = _recursivelyFlatten(s, "", path, value, options); err != nil {
+			return []KeyValue{}, err
+		}
+	}
+
+	return _resolveCollisions(s, options)
+}
+
+// _countValues returns the number of values nested within objects and arrays of a data tree, which is the most
+// key/value pairs the data tree can be flattened to.
+func _countValues(data interface{}) int {
+	n := 0
+	switch v := data.(type) {
+	case *hjson.OrderedMap:
+		for _, key := range v.Keys {
+			n += _countValues(v.Map[key])
+		}
+	case []interface{}:
+		for _, value := range v {
+			n += _countValues(value)
+		}
+	default:
+		n = 1
+	}
+
+	return n
+}
+
+// _resolveCollisions applies the collision policy to key/value pairs with the same key name. The pair that is kept
+// retains its position in the list.
+func _resolveCollisions(list []KeyValue, options Options) ([]KeyValue, error) {
+	indexes := make(map[string]int, len(list))
+	keep := make([]bool, len(list))
+	collided := false
 
-	return _recursivelyFlatten("", result, formatter)
+	for i, kv := range list {
+		j, ok := indexes[kv.Key]
+		if !ok {
+			indexes[kv.Key] = i
+			keep[i] = true
+			continue
+		}
+		collided = true
+
+		switch options.Collisions {
+		case CollisionFirst:
+			// the pair already kept wins
+		case CollisionLast:
+			indexes[kv.Key] = i
+			keep[i], keep[j] = true, false
+		default:
+			return []KeyValue{}, fmt.Errorf("environment variable name collision: %s (from %s and %s)", kv.Key, list[j].Path, kv.Path)
+		}
+	}
+
+	if !collided {
+		return list, nil
+	}
+
+	s := make([]KeyValue, 0, len(list))
+	for i, kv := range list {
+		if keep[i] {
+			s = append(s, kv)
+		}
+	}
+
+	return s, nil
 }
 
-// _recursivelyFlatten is a recursive function that will dig through a gjson.Result and resolve a list of key/value
-// strings wherein keys only appear at the top-level and their named are derived from a flattened path.
+// _recursivelyFlatten is a recursive function that will dig through a data tree and append a list of key/value
+// pairs to s wherein keys only appear at the top-level and their named are derived from a flattened path.
 //
-// See: flattenJSON for examples.
-func _recursivelyFlatten(parent string, result gjson.Result, formatter string) []string {
-	s := make([]string, 0)
-	result.ForEach(func(key, value gjson.Result) bool {
-		keyName := strings.ToUpper(key.String())
-		if !stringutil.IsBlank(parent) {
-			keyName = strings.Join([]string{parent, keyName}, "_")
-		}
-		if value.Type == gjson.JSON {
-			s = append(s, _recursivelyFlatten(keyName, value, formatter)...)
-		} else {
-			s = append(s, fmt.Sprintf(formatter, keyName, value.String()))
-		}
-		return true
-	})
-
-	return s
+// See: Flatten for examples.
+func _recursivelyFlatten(s []KeyValue, parent, parentPath string, data interface{}, options Options) ([]KeyValue, error) {
+	var err error
+
+	switch v := data.(type) {
+	case *hjson.OrderedMap:
+		for _, key := range v.Keys {
+			if s, err = _flattenValue(s, options.keyName(parent, key), JoinPath(parentPath, key), v.Map[key], options); err != nil {
+				return s, err
+			}
+		}
+	case []interface{}:
+		for i, value := range v {
+			index := strconv.Itoa(i)
+			if s, err = _flattenValue(s, options.keyName(parent, index), JoinPath(parentPath, index), value, options); err != nil {
+				return s, err
+			}
+		}
+	}
+
+	return s, nil
+}
+
+// _flattenValue appends the list of key/value pairs for a single named value to s, decoding value directives and
+// recursing into objects and arrays.
+func _flattenValue(s []KeyValue, keyName, path string, value interface{}, options Options) ([]KeyValue, error) {
+	if decoded, ok, err := DecodeDirective(value, path, options); ok {
+		if err != nil {
+			return s, err
+		}
+		return _appendKeyValue(s, KeyValue{Key: keyName, Value: decoded, Path: path, Literal: true}, options)
+	}
+
+	switch v := value.(type) {
+	case *hjson.OrderedMap:
+		return _recursivelyFlatten(s, keyName, path, v, options)
+	case []interface{}:
+		return _flattenArray(s, keyName, path, v, options)
+	}
+
+	if value == nil && options.Nulls == NullUnset {
+		return _appendKeyValue(s, KeyValue{Key: keyName, Unset: true, Path: path}, options)
+	}
+
+	return _appendKeyValue(s, KeyValue{Key: keyName, Value: options.valueToString(value), Path: path}, options)
+}
+
+// _flattenArray appends the list of key/value pairs for a named array to s according to the array policy that applies
+// to the key name.
+func _flattenArray(s []KeyValue, keyName, path string, list []interface{}, options Options) ([]KeyValue, error) {
+	arrayOption := options.arrayOption(keyName)
+
+	switch arrayOption.Policy {
+	case ArrayJoin:
+		values := make([]string, 0, len(list))
+		for i, item := range list {
+			value, err := _joinableString(item, JoinPath(path, strconv.Itoa(i)), options)
+			if err != nil {
+				return s, err
+			}
+			values = append(values, value)
+		}
+		return _appendKeyValue(s, KeyValue{Key: keyName, Value: strings.Join(values, arrayOption.Separator), Path: path}, options)
+	case ArrayJSON:
+		value, err := Marshal(list)
+		if err != nil {
+			return s, err
+		}
+		return _appendKeyValue(s, KeyValue{Key: keyName, Value: string(value), Path: path}, options)
+	case ArrayError:
+		return s, fmt.Errorf("arrays are not supported: %s", keyName)
+	}
+
+	return _recursivelyFlatten(s, keyName, path, list, options)
+}
+
+// _appendKeyValue appends the key/value pair to s after applying the prefix options and the name policy to its key.
+func _appendKeyValue(s []KeyValue, kv KeyValue, options Options) ([]KeyValue, error) {
+	kv, err := _newKeyValue(kv, options)
+	if err != nil {
+		return s, err
+	}
+
+	return append(s, kv), nil
+}
+
+// _newKeyValue returns the key/value pair after applying the prefix options and the name policy to its key.
+func _newKeyValue(kv KeyValue, options Options) (KeyValue, error) {
+	kv.Key = options.prefixed(kv.Key)
+	if IsValidName(kv.Key) {
+		return kv, nil
+	}
+
+	switch options.Names {
+	case NameError:
+		return kv, fmt.Errorf("invalid environment variable name: %s (from %s)", kv.Key, kv.Path)
+	case NameSanitize:
+		kv.Key = SanitizeName(kv.Key)
+	}
+
+	return kv, nil
+}
+
+// pathKeyEscaper escapes backslashes and periods within keys joined to paths.
+var pathKeyEscaper = strings.NewReplacer(`\`, `\\`, `.`, `\.`)
+
+// JoinPath appends a key to a path, escaping periods within the key (see Get).
+func JoinPath(path, key string) string {
+	if strings.ContainsAny(key, `\.`) {
+		key = pathKeyEscaper.Replace(key)
+	}
+	if path == "" {
+		return key
+	}
+
+	return path + "." + key
+}
+
+// _joinableString returns the string representation of an array element for joining. Value directives are decoded
+// and other objects and arrays nested within the array are represented as JSON.
+func _joinableString(value interface{}, path string, options Options) (string, error) {
+	if decoded, ok, err := DecodeDirective(value, path, options); ok {
+		return decoded, err
+	}
+
+	switch value.(type) {
+	case *hjson.OrderedMap, []interface{}:
+		b, err := Marshal(value)
+		return string(b), err
+	}
+
+	return options.valueToString(value), nil
+}
+
+// Marshal returns the compact JSON encoding of a value from a data tree. Object key order and number literals are
+// preserved and HTML characters are not escaped, at any depth.
+func Marshal(value interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := _marshal(&buf, value); err != nil {
+		return []byte{}, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// _marshal writes the compact JSON encoding of a value to the buffer. Objects and arrays are encoded recursively
+// because the encoding of an ordered map (see hjson.OrderedMap.MarshalJSON) would escape HTML characters.
+func _marshal(buf *bytes.Buffer, value interface{}) error {
+	switch v := value.(type) {
+	case *hjson.OrderedMap:
+		buf.WriteByte('{')
+		for i, key := range v.Keys {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := _marshal(buf, key); err != nil {
+				return err
+			}
+			buf.WriteByte(':')
+			if err := _marshal(buf, v.Map[key]); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+		return nil
+	case []interface{}:
+		buf.WriteByte('[')
+		for i, item := range v {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := _marshal(buf, item); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+		return nil
+	}
+
+	var scalar bytes.Buffer
+	encoder := json.NewEncoder(&scalar)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(value); err != nil {
+		return err
+	}
+	buf.Write(bytes.TrimSuffix(scalar.Bytes(), []byte("\n")))
+
+	return nil
+}
+
+// ValueToString returns the string representation of a scalar value. Numbers are returned exactly as they appear in
+// the source data and null values are returned as empty strings.
+func ValueToString(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		return strconv.FormatBool(v)
+	}
+
+	return fmt.Sprintf("%v", value)
 }
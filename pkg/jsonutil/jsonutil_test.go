@@ -0,0 +1,753 @@
+package jsonutil_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/hjson/hjson-go/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+
+	"github.com/markeissler/injector/pkg/jsonutil"
+)
+
+const testDocument = `{
+	// comments are supported
+	environment: {
+		zone: us-east1
+		account_id: 1234567890123456789
+		ratio: 1.50
+		app: {
+			name: test-app
+			debug: false
+		}
+		hosts: ["a", "b"]
+		empty: null
+	}
+}`
+
+func TestJSONUtil_Flatten(t *testing.T) {
+	data, err := jsonutil.Parse([]byte(testDocument))
+	require.NoError(t, err)
+
+	expected := []string{
+		`ZONE="us-east1"`,
+		`ACCOUNT_ID="1234567890123456789"`,
+		`RATIO="1.50"`,
+		`APP_NAME="test-app"`,
+		`APP_DEBUG="false"`,
+		`HOSTS_0="a"`,
+		`HOSTS_1="b"`,
+		`EMPTY=""`,
+	}
+	list, err := jsonutil.Flatten(data, "environment", `%s="%s"`, jsonutil.Options{})
+	require.NoError(t, err)
+	assert.Equal(t, expected, list)
+}
+
+func TestJSONUtil_FlattenKeyValues_ArrayPolicies(t *testing.T) {
+	data, err := jsonutil.Parse([]byte(`{
+		environment: {
+			hosts: ["a", "b"]
+			servers: [
+				{ name: "web", ports: [80, 443] }
+				{ name: "db", ports: [5432] }
+			]
+		}
+	}`))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		options  jsonutil.Options
+		expected []jsonutil.KeyValue
+	}{
+		{
+			name:    "indexed",
+			options: jsonutil.Options{},
+			expected: []jsonutil.KeyValue{
+				{Key: "HOSTS_0", Value: "a"},
+				{Key: "HOSTS_1", Value: "b"},
+				{Key: "SERVERS_0_NAME", Value: "web"},
+				{Key: "SERVERS_0_PORTS_0", Value: "80"},
+				{Key: "SERVERS_0_PORTS_1", Value: "443"},
+				{Key: "SERVERS_1_NAME", Value: "db"},
+				{Key: "SERVERS_1_PORTS_0", Value: "5432"},
+			},
+		},
+		{
+			name:    "join",
+			options: jsonutil.Options{Arrays: jsonutil.ArrayOption{Policy: jsonutil.ArrayJoin}},
+			expected: []jsonutil.KeyValue{
+				{Key: "HOSTS", Value: "a,b"},
+				{Key: "SERVERS", Value: `{"name":"web","ports":[80,443]},{"name":"db","ports":[5432]}`},
+			},
+		},
+		{
+			name:    "json",
+			options: jsonutil.Options{Arrays: jsonutil.ArrayOption{Policy: jsonutil.ArrayJSON}},
+			expected: []jsonutil.KeyValue{
+				{Key: "HOSTS", Value: `["a","b"]`},
+				{Key: "SERVERS", Value: `[{"name":"web","ports":[80,443]},{"name":"db","ports":[5432]}]`},
+			},
+		},
+		{
+			name: "per key",
+			options: jsonutil.Options{
+				Arrays: jsonutil.ArrayOption{Policy: jsonutil.ArrayError},
+				ArraysByKey: map[string]jsonutil.ArrayOption{
+					"HOSTS":           {Policy: jsonutil.ArrayJoin, Separator: ";"},
+					"SERVERS":         {Policy: jsonutil.ArrayIndexed},
+					"SERVERS_0_PORTS": {Policy: jsonutil.ArrayJoin, Separator: " "},
+					"SERVERS_1_PORTS": {Policy: jsonutil.ArrayJSON},
+				},
+			},
+			expected: []jsonutil.KeyValue{
+				{Key: "HOSTS", Value: "a;b"},
+				{Key: "SERVERS_0_NAME", Value: "web"},
+				{Key: "SERVERS_0_PORTS", Value: "80 443"},
+				{Key: "SERVERS_1_NAME", Value: "db"},
+				{Key: "SERVERS_1_PORTS", Value: "[5432]"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		list, err := jsonutil.FlattenKeyValues(data, "environment", tt.options)
+		require.NoError(t, err, tt.name)
+		assert.Equal(t, tt.expected, withoutPaths(list), tt.name)
+	}
+
+	_, err = jsonutil.FlattenKeyValues(data, "environment", jsonutil.Options{
+		Arrays:      jsonutil.ArrayOption{Policy: jsonutil.ArrayError},
+		ArraysByKey: map[string]jsonutil.ArrayOption{"HOSTS": {Policy: jsonutil.ArrayJoin}},
+	})
+	assert.EqualError(t, err, "arrays are not supported: SERVERS")
+}
+
+func TestJSONUtil_FlattenKeyValues_ArraysNoHTMLEscape(t *testing.T) {
+	data, err := jsonutil.Parse([]byte(`{ environment: { b: [{ x: "<a&b>", y: { z: ["<c>"] } }] } }`))
+	require.NoError(t, err)
+
+	list, err := jsonutil.FlattenKeyValues(data, "environment",
+		jsonutil.Options{Arrays: jsonutil.ArrayOption{Policy: jsonutil.ArrayJSON}})
+	require.NoError(t, err)
+	assert.Equal(t, []jsonutil.KeyValue{{Key: "B", Value: `[{"x":"<a&b>","y":{"z":["<c>"]}}]`}}, withoutPaths(list))
+}
+
+func TestJSONUtil_FlattenKeyValues_ValueSemantics(t *testing.T) {
+	data, err := jsonutil.Parse([]byte(`{
+		environment: {
+			enabled: true
+			disabled: false
+			quoted: "false"
+			ratio: 0.125
+			count: 42
+			proxy: null
+			flags: [true, false]
+		}
+	}`))
+	require.NoError(t, err)
+
+	list, err := jsonutil.FlattenKeyValues(data, "environment", jsonutil.Options{
+		Arrays:      jsonutil.ArrayOption{Policy: jsonutil.ArrayJoin},
+		Nulls:       jsonutil.NullUnset,
+		Booleans:    jsonutil.BoolOneZero,
+		FloatFormat: "%.2f",
+	})
+	require.NoError(t, err)
+
+	expected := []jsonutil.KeyValue{
+		{Key: "ENABLED", Value: "1"},
+		{Key: "DISABLED", Value: "0"},
+		{Key: "QUOTED", Value: "false"},
+		{Key: "RATIO", Value: "0.12"},
+		{Key: "COUNT", Value: "42"},
+		{Key: "PROXY", Unset: true},
+		{Key: "FLAGS", Value: "1,0"},
+	}
+	assert.Equal(t, expected, withoutPaths(list))
+
+	list, err = jsonutil.FlattenKeyValues(data, "environment", jsonutil.Options{Booleans: jsonutil.BoolYesNo})
+	require.NoError(t, err)
+	assert.Equal(t, jsonutil.KeyValue{Key: "ENABLED", Value: "yes", Path: "environment.enabled"}, list[0])
+	assert.Equal(t, jsonutil.KeyValue{Key: "PROXY", Value: "", Path: "environment.proxy"}, list[5])
+}
+
+func TestJSONUtil_FlattenKeyValues_NamePolicies(t *testing.T) {
+	data, err := jsonutil.Parse([]byte(`{
+		environment: {
+			"new-relic": { key: "abc" }
+			"1password": "def"
+			"a.b": "ghi"
+		}
+	}`))
+	require.NoError(t, err)
+
+	_, err = jsonutil.FlattenKeyValues(data, "environment", jsonutil.Options{Names: jsonutil.NameError})
+	assert.EqualError(t, err, "invalid environment variable name: NEW-RELIC_KEY (from environment.new-relic.key)")
+
+	list, err := jsonutil.FlattenKeyValues(data, "environment", jsonutil.Options{})
+	require.NoError(t, err)
+	assert.Equal(t, "NEW-RELIC_KEY", list[0].Key)
+
+	list, err = jsonutil.FlattenKeyValues(data, "environment", jsonutil.Options{Names: jsonutil.NameSanitize})
+	require.NoError(t, err)
+	expected := []jsonutil.KeyValue{
+		{Key: "NEW_RELIC_KEY", Value: "abc", Path: "environment.new-relic.key"},
+		{Key: "_1PASSWORD", Value: "def", Path: "environment.1password"},
+		{Key: "A_B", Value: "ghi", Path: `environment.a\.b`},
+	}
+	assert.Equal(t, expected, list)
+
+	list, err = jsonutil.FlattenKeyValues(data, "environment", jsonutil.Options{Names: jsonutil.NameAllow})
+	require.NoError(t, err)
+	assert.Equal(t, "NEW-RELIC_KEY", list[0].Key)
+	assert.Equal(t, "A.B", list[2].Key)
+}
+
+func TestJSONUtil_FlattenKeyValues_CollisionPolicies(t *testing.T) {
+	data, err := jsonutil.Parse([]byte(`{ environment: { a_b: "1", a: { b: "2" }, c: "3" } }`))
+	require.NoError(t, err)
+
+	_, err = jsonutil.FlattenKeyValues(data, "environment", jsonutil.Options{})
+	assert.EqualError(t, err, "environment variable name collision: A_B (from environment.a_b and environment.a.b)")
+
+	list, err := jsonutil.FlattenKeyValues(data, "environment", jsonutil.Options{Collisions: jsonutil.CollisionFirst})
+	require.NoError(t, err)
+	assert.Equal(t, []jsonutil.KeyValue{{Key: "A_B", Value: "1"}, {Key: "C", Value: "3"}}, withoutPaths(list))
+
+	list, err = jsonutil.FlattenKeyValues(data, "environment", jsonutil.Options{Collisions: jsonutil.CollisionLast})
+	require.NoError(t, err)
+	assert.Equal(t, []jsonutil.KeyValue{{Key: "A_B", Value: "2"}, {Key: "C", Value: "3"}}, withoutPaths(list))
+}
+
+func TestJSONUtil_FlattenKeyValues_KeyNaming(t *testing.T) {
+	data, err := jsonutil.Parse([]byte(`{
+		environment: {
+			Logging: { LogLevel: { Default: "Warning" } }
+			MYAPP_TOKEN: "abc"
+		}
+	}`))
+	require.NoError(t, err)
+
+	list, err := jsonutil.FlattenKeyValues(data, "environment", jsonutil.Options{
+		Separator: "__",
+		Case:      jsonutil.CasePreserve,
+	})
+	require.NoError(t, err)
+	expected := []jsonutil.KeyValue{
+		{Key: "Logging__LogLevel__Default", Value: "Warning"},
+		{Key: "MYAPP_TOKEN", Value: "abc"},
+	}
+	assert.Equal(t, expected, withoutPaths(list))
+
+	list, err = jsonutil.FlattenKeyValues(data, "environment", jsonutil.Options{
+		StripPrefix: "MYAPP_",
+		Prefix:      "BILLING_",
+	})
+	require.NoError(t, err)
+	expected = []jsonutil.KeyValue{
+		{Key: "BILLING_LOGGING_LOGLEVEL_DEFAULT", Value: "Warning"},
+		{Key: "BILLING_TOKEN", Value: "abc"},
+	}
+	assert.Equal(t, expected, withoutPaths(list))
+
+	list, err = jsonutil.FlattenKeyValues(data, "environment", jsonutil.Options{Case: jsonutil.CaseLower})
+	require.NoError(t, err)
+	assert.Equal(t, "logging_loglevel_default", list[0].Key)
+}
+
+func TestJSONUtil_FlattenRoots(t *testing.T) {
+	data, err := jsonutil.Parse([]byte(`{
+		environment: { log_level: "info", region: "us" }
+		services: {
+			billing: { environment: { log_level: "debug", currency: "usd" } }
+		}
+	}`))
+	require.NoError(t, err)
+
+	list, err := jsonutil.FlattenRoots(data, []string{"services.billing.environment", "missing"}, jsonutil.Options{})
+	require.NoError(t, err)
+	expected := []jsonutil.KeyValue{
+		{Key: "LOG_LEVEL", Value: "debug", Path: "services.billing.environment.log_level"},
+		{Key: "CURRENCY", Value: "usd", Path: "services.billing.environment.currency"},
+	}
+	assert.Equal(t, expected, list)
+
+	roots := []string{"environment", "services.billing.environment"}
+	_, err = jsonutil.FlattenRoots(data, roots, jsonutil.Options{})
+	assert.EqualError(t, err,
+		"environment variable name collision: LOG_LEVEL (from environment.log_level and services.billing.environment.log_level)")
+
+	list, err = jsonutil.FlattenRoots(data, roots, jsonutil.Options{Collisions: jsonutil.CollisionLast})
+	require.NoError(t, err)
+	expected = []jsonutil.KeyValue{
+		{Key: "REGION", Value: "us"},
+		{Key: "LOG_LEVEL", Value: "debug"},
+		{Key: "CURRENCY", Value: "usd"},
+	}
+	assert.Equal(t, expected, withoutPaths(list))
+}
+
+func TestJSONUtil_IsValidName(t *testing.T) {
+	assert.True(t, jsonutil.IsValidName("_PRIVATE_1"))
+	assert.False(t, jsonutil.IsValidName("1PASSWORD"))
+	assert.False(t, jsonutil.IsValidName("NEW-RELIC"))
+	assert.False(t, jsonutil.IsValidName("CAFÉ"))
+	assert.False(t, jsonutil.IsValidName(""))
+	assert.Equal(t, "CAF_", jsonutil.SanitizeName("CAFÉ"))
+}
+
+func TestJSONUtil_ValidateFloatFormat(t *testing.T) {
+	assert.NoError(t, jsonutil.ValidateFloatFormat(""))
+	assert.NoError(t, jsonutil.ValidateFloatFormat("%.3e"))
+	assert.Error(t, jsonutil.ValidateFloatFormat("%d"))
+	assert.Error(t, jsonutil.ValidateFloatFormat("fixed"))
+}
+
+func TestJSONUtil_ParseArrayPolicy(t *testing.T) {
+	policy, err := jsonutil.ParseArrayPolicy("JSON")
+	require.NoError(t, err)
+	assert.Equal(t, jsonutil.ArrayJSON, policy)
+
+	policy, err = jsonutil.ParseArrayPolicy("")
+	require.NoError(t, err)
+	assert.Equal(t, jsonutil.ArrayIndexed, policy)
+
+	_, err = jsonutil.ParseArrayPolicy("csv")
+	assert.Error(t, err)
+}
+
+func TestJSONUtil_Parse_Blank(t *testing.T) {
+	data, err := jsonutil.Parse([]byte(" \n"))
+	require.NoError(t, err)
+	assert.Equal(t, 0, data.Len())
+}
+
+func TestJSONUtil_Get(t *testing.T) {
+	data, err := jsonutil.Parse([]byte(`{ "a.b": { c: [1, { d: "found" }] } }`))
+	require.NoError(t, err)
+
+	value, ok := jsonutil.Get(data, `a\.b.c.1.d`)
+	assert.True(t, ok)
+	assert.Equal(t, "found", value)
+
+	_, ok = jsonutil.Get(data, `a\.b.c.2`)
+	assert.False(t, ok)
+
+	_, ok = jsonutil.Get(data, `a.b`)
+	assert.False(t, ok)
+}
+
+// benchmarkDocument returns a document with the given number of nested sections.
+func benchmarkDocument(sections int) []byte {
+	var b strings.Builder
+
+	b.WriteString("{\n  environment: {\n")
+	for i := 0; i < sections; i++ {
+		fmt.Fprintf(&b, "    section_%d: {\n      id: 1234567890123456789\n      name: name-%d\n      enabled: true\n    }\n", i, i)
+	}
+	b.WriteString("  }\n}\n")
+
+	return []byte(b.String())
+}
+
+// BenchmarkJSONUtil_Flatten measures parsing and flattening a document with the ordered representation.
+func BenchmarkJSONUtil_Flatten(b *testing.B) {
+	document := benchmarkDocument(100)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		data, err := jsonutil.Parse(document)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if _, err = jsonutil.FlattenKeyValues(data, "environment", jsonutil.Options{}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkJSONUtil_Flatten_MarshalRoundTrip measures the previous approach to parsing and flattening a document, in
+// which the parsed map was marshaled back to JSON so that it could be walked with gjson.
+func BenchmarkJSONUtil_Flatten_MarshalRoundTrip(b *testing.B) {
+	document := benchmarkDocument(100)
+
+	var flatten func(parent string, result gjson.Result) []jsonutil.KeyValue
+	flatten = func(parent string, result gjson.Result) []jsonutil.KeyValue {
+		s := make([]jsonutil.KeyValue, 0)
+		result.ForEach(func(key, value gjson.Result) bool {
+			keyName := strings.ToUpper(key.String())
+			if parent != "" {
+				keyName = parent + "_" + keyName
+			}
+			if value.Type == gjson.JSON {
+				s = append(s, flatten(keyName, value)...)
+			} else {
+				s = append(s, jsonutil.KeyValue{Key: keyName, Value: value.String()})
+			}
+			return true
+		})
+		return s
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		data := make(map[string]interface{})
+		if err := hjson.Unmarshal(document, &data); err != nil {
+			b.Fatal(err)
+		}
+		jsonBytes, err := json.Marshal(data)
+		if err != nil {
+			b.Fatal(err)
+		}
+		flatten("", gjson.GetBytes(jsonBytes, "environment"))
+	}
+}
+
+// withoutPaths returns a copy of the list with document paths cleared, for comparisons that only concern names and
+// values.
+func withoutPaths(list []jsonutil.KeyValue) []jsonutil.KeyValue {
+	s := make([]jsonutil.KeyValue, 0, len(list))
+	for _, kv := range list {
+		kv.Path = ""
+		s = append(s, kv)
+	}
+
+	return s
+}
+
+func TestJSONUtil_Filter(t *testing.T) {
+	list := []jsonutil.KeyValue{
+		{Key: "NEW_RELIC_KEY", Value: "a", Path: "environment.new_relic.key"},
+		{Key: "NEW_RELIC_DEBUG", Value: "b", Path: "environment.new_relic.debug"},
+		{Key: "DATABASE_URL", Value: "c", Path: "environment.database_url"},
+	}
+
+	filter := jsonutil.Filter{Only: []string{"environment.new_relic.*"}, Exclude: []string{"*_DEBUG"}}
+	require.NoError(t, filter.Validate())
+
+	kept, removed := filter.Apply(list)
+	assert.Equal(t, list[:1], kept)
+	require.Len(t, removed, 2)
+	assert.Equal(t, "excluded by *_DEBUG", removed[0].Reason)
+	assert.Equal(t, "DATABASE_URL", removed[1].Key)
+
+	kept, removed = jsonutil.Filter{}.Apply(list)
+	assert.Equal(t, list, kept)
+	assert.Empty(t, removed)
+
+	assert.Error(t, jsonutil.Filter{Exclude: []string{"[A-"}}.Validate())
+}
+
+func TestJSONUtil_Mapping(t *testing.T) {
+	data, err := jsonutil.Parse([]byte(`{
+		rename: { DB_URL: "DATABASE_URL" }
+		alias: { API_TOKEN: "GITHUB_TOKEN" }
+	}`))
+	require.NoError(t, err)
+
+	mapping, err := jsonutil.ParseMapping(data)
+	require.NoError(t, err)
+
+	list := []jsonutil.KeyValue{
+		{Key: "DB_URL", Value: "postgres://db", Path: "environment.db_url"},
+		{Key: "API_TOKEN", Value: "abc", Path: "environment.api_token"},
+	}
+	mapped, err := mapping.Apply(list, jsonutil.Options{})
+	require.NoError(t, err)
+	expected := []jsonutil.KeyValue{
+		{Key: "DATABASE_URL", Value: "postgres://db", Path: "environment.db_url"},
+		{Key: "API_TOKEN", Value: "abc", Path: "environment.api_token"},
+		{Key: "GITHUB_TOKEN", Value: "abc", Path: "environment.api_token"},
+	}
+	assert.Equal(t, expected, mapped)
+
+	require.NoError(t, jsonutil.ParseMappingSpec(mapping.Alias, "DB_URL=API_TOKEN"))
+	_, err = mapping.Apply(list, jsonutil.Options{})
+	assert.EqualError(t, err,
+		"environment variable name collision: API_TOKEN (from environment.api_token and environment.db_url aliased from DB_URL)")
+
+	mapping = jsonutil.NewMapping()
+	require.NoError(t, jsonutil.ParseMappingSpec(mapping.Rename, "DB_URL=database-url"))
+	_, err = mapping.Apply(list, jsonutil.Options{Names: jsonutil.NameError})
+	assert.Error(t, err)
+	_, err = mapping.Apply(list, jsonutil.Options{})
+	assert.NoError(t, err)
+
+	assert.Error(t, jsonutil.ParseMappingSpec(mapping.Rename, "DB_URL"))
+	_, err = jsonutil.ParseMapping(jsonutil.KeyValue{})
+	assert.Error(t, err)
+}
+
+func TestJSONUtil_Interpolate(t *testing.T) {
+	data, err := jsonutil.Parse([]byte(`{
+		shared: { domain: "example.com" }
+		environment: {
+			db: {
+				host: "db.${shared.domain}"
+				port: 5432
+			}
+			database_url: "postgres://${DB_HOST}:${environment.db.port}/app"
+			log_level: "${LOG_LEVEL_OVERRIDE:-info}"
+			price: "$$5 and $HOME"
+			home: "${HOME:-/root}"
+		}
+	}`))
+	require.NoError(t, err)
+
+	list, err := jsonutil.FlattenKeyValues(data, "environment", jsonutil.Options{})
+	require.NoError(t, err)
+
+	interpolated, err := jsonutil.Interpolate(data, list, nil, jsonutil.Options{})
+	require.NoError(t, err)
+	expected := []jsonutil.KeyValue{
+		{Key: "DB_HOST", Value: "db.example.com"},
+		{Key: "DB_PORT", Value: "5432"},
+		{Key: "DATABASE_URL", Value: "postgres://db.example.com:5432/app"},
+		{Key: "LOG_LEVEL", Value: "info"},
+		{Key: "PRICE", Value: "$5 and $HOME"},
+		{Key: "HOME", Value: "/root"},
+	}
+	assert.Equal(t, expected, withoutPaths(interpolated))
+
+	interpolated, err = jsonutil.Interpolate(data, list, map[string]string{"LOG_LEVEL_OVERRIDE": "debug"}, jsonutil.Options{})
+	require.NoError(t, err)
+	assert.Equal(t, "debug", interpolated[3].Value)
+}
+
+func TestJSONUtil_Interpolate_Errors(t *testing.T) {
+	tests := []struct {
+		document string
+		expected string
+	}{
+		{
+			document: `{ environment: { a: "${B}", b: "${C}", c: "${environment.a}" } }`,
+			expected: "interpolation cycle: A -> B -> C -> A",
+		},
+		{
+			document: `{ environment: { a: "${MISSING}" } }`,
+			expected: "unresolved interpolation reference: ${MISSING} in A",
+		},
+		{
+			document: `{ environment: { a: "${B" } }`,
+			expected: "unterminated interpolation reference: ${B",
+		},
+		{
+			document: `{ environment: { a: "${environment}" } }`,
+			expected: "interpolation reference is not a scalar value: environment",
+		},
+	}
+
+	for _, tt := range tests {
+		data, err := jsonutil.Parse([]byte(tt.document))
+		require.NoError(t, err)
+
+		list, err := jsonutil.FlattenKeyValues(data, "environment", jsonutil.Options{})
+		require.NoError(t, err)
+
+		_, err = jsonutil.Interpolate(data, list, map[string]string{}, jsonutil.Options{})
+		assert.EqualError(t, err, tt.expected)
+	}
+}
+
+func TestJSONUtil_Merge(t *testing.T) {
+	base, err := jsonutil.Parse([]byte(`{ environment: { log_level: "info", otel: { endpoint: "a", insecure: true } }, b: 1 }`))
+	require.NoError(t, err)
+	overlay, err := jsonutil.Parse([]byte(`{ environment: { otel: { endpoint: "b" }, app: "x" }, c: 2 }`))
+	require.NoError(t, err)
+
+	merged := jsonutil.Merge(base, overlay)
+	b, err := jsonutil.Marshal(merged)
+	require.NoError(t, err)
+	assert.Equal(t,
+		`{"environment":{"log_level":"info","otel":{"endpoint":"b","insecure":true},"app":"x"},"b":1,"c":2}`, string(b))
+
+	b, err = jsonutil.Marshal(base)
+	require.NoError(t, err)
+	assert.Equal(t, `{"environment":{"log_level":"info","otel":{"endpoint":"a","insecure":true}},"b":1}`, string(b))
+}
+
+func TestJSONUtil_FlattenKeyValues_Directives(t *testing.T) {
+	data, err := jsonutil.Parse([]byte(`{
+		environment: {
+			greeting: { $base64: "aGVsbG8g\n JHt3b3JsZH0=" }
+			key: { $hex: "6b 65 79" }
+			cert: { $file: "/etc/app/cert.pem" }
+			hostname: { $env: "HOSTNAME" }
+			hosts: [{ $hex: "61" }, "b"]
+			message: "${environment.key}-${HOSTNAME}"
+		}
+	}`))
+	require.NoError(t, err)
+
+	options := jsonutil.Options{
+		Arrays: jsonutil.ArrayOption{Policy: jsonutil.ArrayJoin},
+		LookupEnv: func(key string) (string, bool) {
+			return map[string]string{"HOSTNAME": "web-1"}[key], key == "HOSTNAME"
+		},
+		ReadFile: func(filename string) ([]byte, error) {
+			return []byte("cert from " + filename), nil
+		},
+	}
+	list, err := jsonutil.FlattenKeyValues(data, "environment", options)
+	require.NoError(t, err)
+
+	list, err = jsonutil.Interpolate(data, list, nil, options)
+	require.NoError(t, err)
+
+	values := make(map[string]string)
+	for _, kv := range list {
+		values[kv.Key] = kv.Value
+	}
+	assert.Equal(t, map[string]string{
+		"GREETING": "hello ${world}",
+		"KEY":      "key",
+		"CERT":     "cert from /etc/app/cert.pem",
+		"HOSTNAME": "web-1",
+		"HOSTS":    "a,b",
+		"MESSAGE":  "key-web-1",
+	}, values)
+
+	tests := []struct {
+		document string
+		expected string
+	}{
+		{`{ a: { $base64: "!!" } }`, "failed to decode $base64 value (a): illegal base64 data at input byte 0"},
+		{`{ a: { $env: "MISSING" } }`, "environment variable not set: MISSING (from a)"},
+		{`{ a: { $gzip: "x" } }`, "unsupported value directive: $gzip (a)"},
+		{`{ a: { $hex: 1 } }`, "value directive $hex requires a string: a"},
+		{`{ a: { $hex: "00" } }`, "decoded $hex value contains a NUL character (a)"},
+	}
+	for _, tt := range tests {
+		data, err = jsonutil.Parse([]byte(tt.document))
+		require.NoError(t, err)
+
+		_, err = jsonutil.FlattenKeyValues(data, "", options)
+		assert.EqualError(t, err, tt.expected)
+	}
+}
+
+func TestJSONUtil_ApplyConditions(t *testing.T) {
+	data, err := jsonutil.Parse([]byte(`{
+		environment: { log_level: "debug", replicas: 1 }
+		when: [
+			{ if: { env: "prod" }, environment: { log_level: "warn", replicas: 3 } }
+			{ if: { env: ["prod", "staging"], hostname: "web-*" }, environment: { role: "web" } }
+			{ if: { region: "eu-*" }, environment: { replicas: 2 } }
+		]
+	}`))
+	require.NoError(t, err)
+
+	tests := []struct {
+		selectors map[string]string
+		expected  string
+		applied   []int
+	}{
+		{
+			selectors: map[string]string{},
+			expected:  `{"environment":{"log_level":"debug","replicas":1}}`,
+			applied:   []int{},
+		},
+		{
+			selectors: map[string]string{"env": "prod", "hostname": "web-1"},
+			expected:  `{"environment":{"log_level":"warn","replicas":3,"role":"web"}}`,
+			applied:   []int{0, 1},
+		},
+		{
+			selectors: map[string]string{"env": "staging", "hostname": "db-1", "region": "eu-west1"},
+			expected:  `{"environment":{"log_level":"debug","replicas":2}}`,
+			applied:   []int{2},
+		},
+	}
+
+	for _, tt := range tests {
+		selected, applied, err := jsonutil.ApplyConditions(data, tt.selectors)
+		require.NoError(t, err)
+
+		b, err := jsonutil.Marshal(selected)
+		require.NoError(t, err)
+		assert.Equal(t, tt.expected, string(b))
+		assert.Equal(t, tt.applied, applied)
+	}
+
+	data, err = jsonutil.Parse([]byte(`{ when: [{ environment: {} }] }`))
+	require.NoError(t, err)
+	_, _, err = jsonutil.ApplyConditions(data, map[string]string{})
+	assert.EqualError(t, err, "conditional block requires an object of conditions: when.0.if")
+}
+
+func TestJSONUtil_ApplyDefaults(t *testing.T) {
+	data, err := jsonutil.Parse([]byte(`{
+		environment: { log_level: "debug", proxy: null }
+		defaults: { LOG_LEVEL: "info", PORT: 8080, PROXY: "http://proxy", TOKEN: { $hex: "6b6579" } }
+	}`))
+	require.NoError(t, err)
+
+	options := jsonutil.Options{Nulls: jsonutil.NullUnset}
+	list, err := jsonutil.FlattenKeyValues(data, "environment", options)
+	require.NoError(t, err)
+
+	defaults, _ := jsonutil.Get(data, "defaults")
+	list, err = jsonutil.ApplyDefaults(list, defaults, "defaults", options)
+	require.NoError(t, err)
+
+	expected := []jsonutil.KeyValue{
+		{Key: "LOG_LEVEL", Value: "debug", Path: "environment.log_level"},
+		{Key: "PROXY", Unset: true, Path: "environment.proxy"},
+		{Key: "PORT", Value: "8080", Path: "defaults.PORT"},
+		{Key: "TOKEN", Value: "key", Path: "defaults.TOKEN", Literal: true},
+	}
+	assert.Equal(t, expected, list)
+}
+
+func TestJSONUtil_Missing(t *testing.T) {
+	required, err := jsonutil.ParseRequired([]interface{}{"A", "B", "C", "D", "A"}, "required")
+	require.NoError(t, err)
+
+	list := []jsonutil.KeyValue{{Key: "A", Value: ""}, {Key: "B", Unset: true}}
+	assert.Equal(t, []string{"B", "C", "D"}, jsonutil.Missing(list, required, nil, jsonutil.Options{}))
+
+	inherited := func(name string) bool { return name == "B" || name == "C" }
+	assert.Equal(t, []string{"B", "D"}, jsonutil.Missing(list, required, inherited, jsonutil.Options{}))
+
+	options := jsonutil.Options{Prefix: "MYAPP_", StripPrefix: "LEGACY_"}
+	list = []jsonutil.KeyValue{{Key: "MYAPP_A", Value: ""}, {Key: "MYAPP_PORT", Value: "80"}}
+	required = []string{"A", "LEGACY_PORT", "B", "MYAPP_A"}
+	assert.Equal(t, []string{"MYAPP_B", "MYAPP_MYAPP_A"}, jsonutil.Missing(list, required, nil, options))
+
+	_, err = jsonutil.ParseRequired([]interface{}{"A", 1}, "required")
+	assert.EqualError(t, err, "required must be an array of strings: required.1")
+}
+
+func TestJSONUtil_ApplyDefaults_Prefix(t *testing.T) {
+	data, err := jsonutil.Parse([]byte(`{
+		environment: { log_level: "debug", legacy_port: 80 }
+		defaults: { LOG_LEVEL: "info", LEGACY_PORT: 8080, HOME: { $env: "INJECTOR_TEST_UNSET" }, TIMEOUT: 30 }
+	}`))
+	require.NoError(t, err)
+
+	options := jsonutil.Options{Prefix: "MYAPP_", StripPrefix: "LEGACY_"}
+	options.LookupEnv = func(name string) (string, bool) { return "", false }
+	list, err := jsonutil.FlattenKeyValues(data, "environment", options)
+	require.NoError(t, err)
+
+	// HOME is generated from another root so its default, whose directive can't be decoded, isn't used.
+	list = append(list, jsonutil.KeyValue{Key: "MYAPP_HOME", Value: "/root", Path: "other.home"})
+
+	defaults, _ := jsonutil.Get(data, "defaults")
+	list, err = jsonutil.ApplyDefaults(list, defaults, "defaults", options)
+	require.NoError(t, err)
+
+	expected := []jsonutil.KeyValue{
+		{Key: "MYAPP_LOG_LEVEL", Value: "debug", Path: "environment.log_level"},
+		{Key: "MYAPP_PORT", Value: "80", Path: "environment.legacy_port"},
+		{Key: "MYAPP_HOME", Value: "/root", Path: "other.home"},
+		{Key: "MYAPP_TIMEOUT", Value: "30", Path: "defaults.TIMEOUT"},
+	}
+	assert.Equal(t, expected, list)
+}
@@ -0,0 +1,132 @@
+package jsonutil
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hjson/hjson-go/v4"
+)
+
+// Mapping renames and duplicates flattened key/value pairs. Rename maps a generated key name to the name it will be
+// replaced with and Alias maps a generated key name to an additional name that receives a copy of its value. Both
+// maps are keyed by the generated names (before mapping is applied) so mappings aren't chained.
+type Mapping struct {
+	Rename map[string]string
+	Alias  map[string]string
+}
+
+// NewMapping returns an empty Mapping.
+func NewMapping() Mapping {
+	return Mapping{
+		Rename: map[string]string{},
+		Alias:  map[string]string{},
+	}
+}
+
+// ParseMapping returns the Mapping described by a data tree object with optional `rename` and `alias` objects, each of
+// which maps generated key names to target names. For example:
+//
+// ```json
+// {
+//     "rename": { "DB_URL": "DATABASE_URL" },
+//     "alias": { "API_TOKEN": "GITHUB_TOKEN" }
+// }
+// ```
+func ParseMapping(data interface{}) (Mapping, error) {
+	mapping := NewMapping()
+
+	object, ok := data.(*hjson.OrderedMap)
+	if !ok {
+		return mapping, fmt.Errorf("mapping must be an object")
+	}
+
+	for _, section := range object.Keys {
+		var target map[string]string
+		switch section {
+		case "rename":
+			target = mapping.Rename
+		case "alias":
+			target = mapping.Alias
+		default:
+			return mapping, fmt.Errorf("unsupported mapping section: %s", section)
+		}
+
+		names, ok := object.Map[section].(*hjson.OrderedMap)
+		if !ok {
+			return mapping, fmt.Errorf("mapping section must be an object: %s", section)
+		}
+		for _, from := range names.Keys {
+			to, ok := names.Map[from].(string)
+			if !ok {
+				return mapping, fmt.Errorf("mapping target must be a string: %s.%s", section, from)
+			}
+			target[from] = to
+		}
+	}
+
+	return mapping, nil
+}
+
+// ParseMappingSpec adds a mapping specified as `FROM=TO` to the target map (either Rename or Alias).
+func ParseMappingSpec(target map[string]string, spec string) error {
+	parts := strings.SplitN(spec, "=", 2)
+	if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" || strings.TrimSpace(parts[1]) == "" {
+		return fmt.Errorf("invalid mapping: %s", spec)
+	}
+	target[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+
+	return nil
+}
+
+// IsEmpty returns true if the mapping has no entries.
+func (m Mapping) IsEmpty() bool {
+	return len(m.Rename) == 0 && len(m.Alias) == 0
+}
+
+// Apply returns the key/value pairs with renames and aliases applied. Renamed pairs retain their position and aliases
+// immediately follow the pair they duplicate. Mappings for names that weren't generated are ignored. An error is
+// returned if a target name isn't a valid environment variable name (unless the name policy is NameAllow, the default)
+// or if it collides with another generated or mapped name.
+func (m Mapping) Apply(list []KeyValue, options Options) ([]KeyValue, error) {
+	sources := make(map[string]string, len(list))
+
+	register := func(name, source string) error {
+		if (options.Names == NameError || options.Names == NameSanitize) && !IsValidName(name) {
+			return fmt.Errorf("invalid environment variable name: %s (mapped from %s)", name, source)
+		}
+		if previous, ok := sources[name]; ok {
+			return fmt.Errorf("environment variable name collision: %s (from %s and %s)", name, previous, source)
+		}
+		sources[name] = source
+
+		return nil
+	}
+
+	renamed := make([]KeyValue, 0, len(list))
+	for _, kv := range list {
+		source := kv.Path
+		if to, ok := m.Rename[kv.Key]; ok {
+			source = fmt.Sprintf("%s renamed from %s", kv.Path, kv.Key)
+			kv.Key = to
+		}
+		if err := register(kv.Key, source); err != nil {
+			return []KeyValue{}, err
+		}
+		renamed = append(renamed, kv)
+	}
+
+	// Aliases are resolved after all renames so collisions are reported against final names.
+	s := make([]KeyValue, 0, len(renamed))
+	for i, kv := range renamed {
+		s = append(s, kv)
+		if to, ok := m.Alias[list[i].Key]; ok {
+			if err := register(to, fmt.Sprintf("%s aliased from %s", kv.Path, list[i].Key)); err != nil {
+				return []KeyValue{}, err
+			}
+			kv.Key = to
+			s = append(s, kv)
+		}
+	}
+
+	return s, nil
+}
@@ -0,0 +1,380 @@
+package jsonutil
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// ArrayPolicy determines how arrays are flattened.
+type ArrayPolicy string
+
+const (
+	// ArrayIndexed flattens each array element to its own key with the element index appended (e.g. `HOSTS_0`).
+	ArrayIndexed ArrayPolicy = "indexed"
+	// ArrayJoin flattens an array to a single key with its elements joined by a separator (e.g. `HOSTS="a,b"`).
+	ArrayJoin ArrayPolicy = "join"
+	// ArrayJSON flattens an array to a single key with the array encoded as JSON (e.g. `HOSTS=["a","b"]`).
+	ArrayJSON ArrayPolicy = "json"
+	// ArrayError causes flattening to fail if an array is found.
+	ArrayError ArrayPolicy = "error"
+)
+
+// DefaultArraySeparator is the separator used to join array elements when no separator has been specified.
+const DefaultArraySeparator = ","
+
+// ArrayPolicies returns the names of all array policies.
+func ArrayPolicies() []string {
+	return []string{string(ArrayIndexed), string(ArrayJoin), string(ArrayJSON), string(ArrayError)}
+}
+
+// ParseArrayPolicy returns the ArrayPolicy identified by name. A blank name resolves to ArrayIndexed.
+func ParseArrayPolicy(name string) (ArrayPolicy, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		return ArrayIndexed, nil
+	}
+
+	for _, p := range ArrayPolicies() {
+		if p == name {
+			return ArrayPolicy(p), nil
+		}
+	}
+
+	return ArrayIndexed, fmt.Errorf("unsupported array policy: %s", name)
+}
+
+// NullPolicy determines how null values are flattened.
+type NullPolicy string
+
+const (
+	// NullEmpty flattens null values to empty strings.
+	NullEmpty NullPolicy = "empty"
+	// NullUnset flattens null values to variables that should be unset, even if otherwise inherited.
+	NullUnset NullPolicy = "unset"
+)
+
+// NullPolicies returns the names of all null policies.
+func NullPolicies() []string {
+	return []string{string(NullEmpty), string(NullUnset)}
+}
+
+// ParseNullPolicy returns the NullPolicy identified by name. A blank name resolves to NullEmpty.
+func ParseNullPolicy(name string) (NullPolicy, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		return NullEmpty, nil
+	}
+
+	for _, p := range NullPolicies() {
+		if p == name {
+			return NullPolicy(p), nil
+		}
+	}
+
+	return NullEmpty, fmt.Errorf("unsupported null policy: %s", name)
+}
+
+// BoolFormat determines how boolean values are flattened.
+type BoolFormat string
+
+const (
+	// BoolTrueFalse flattens booleans to `true` and `false`.
+	BoolTrueFalse BoolFormat = "true-false"
+	// BoolOneZero flattens booleans to `1` and `0`.
+	BoolOneZero BoolFormat = "1-0"
+	// BoolYesNo flattens booleans to `yes` and `no`.
+	BoolYesNo BoolFormat = "yes-no"
+)
+
+// BoolFormats returns the names of all boolean formats.
+func BoolFormats() []string {
+	return []string{string(BoolTrueFalse), string(BoolOneZero), string(BoolYesNo)}
+}
+
+// ParseBoolFormat returns the BoolFormat identified by name. A blank name resolves to BoolTrueFalse.
+func ParseBoolFormat(name string) (BoolFormat, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		return BoolTrueFalse, nil
+	}
+
+	for _, f := range BoolFormats() {
+		if f == name {
+			return BoolFormat(f), nil
+		}
+	}
+
+	return BoolTrueFalse, fmt.Errorf("unsupported boolean format: %s", name)
+}
+
+// ValidateFloatFormat returns an error if the printf style format can't be used to format a floating point number
+// (e.g. `%.2f`).
+func ValidateFloatFormat(format string) error {
+	if format == "" {
+		return nil
+	}
+
+	if s := fmt.Sprintf(format, 1.5); strings.Contains(s, "%!") || s == format {
+		return fmt.Errorf("unsupported float format: %s", format)
+	}
+
+	return nil
+}
+
+// NamePolicy determines how flattened key names that aren't valid POSIX environment variable names are handled.
+type NamePolicy string
+
+const (
+	// NameError causes flattening to fail if an invalid name is found.
+	NameError NamePolicy = "error"
+	// NameSanitize replaces invalid characters in names with underscores.
+	NameSanitize NamePolicy = "sanitize"
+	// NameAllow passes invalid names through unchanged.
+	NameAllow NamePolicy = "allow"
+)
+
+// NamePolicies returns the names of all name policies.
+func NamePolicies() []string {
+	return []string{string(NameError), string(NameSanitize), string(NameAllow)}
+}
+
+// ParseNamePolicy returns the NamePolicy identified by name. A blank name resolves to NameAllow.
+func ParseNamePolicy(name string) (NamePolicy, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		return NameAllow, nil
+	}
+
+	for _, p := range NamePolicies() {
+		if p == name {
+			return NamePolicy(p), nil
+		}
+	}
+
+	return NameAllow, fmt.Errorf("unsupported name policy: %s", name)
+}
+
+// validName matches valid POSIX environment variable names.
+var validName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// IsValidName returns true if the name is a valid POSIX environment variable name, consisting of ASCII letters, digits
+// and underscores and not beginning with a digit.
+func IsValidName(name string) bool {
+	return validName.MatchString(name)
+}
+
+// SanitizeName returns the name with each character that isn't valid in a POSIX environment variable name replaced by
+// an underscore. An underscore is prepended to names beginning with a digit.
+func SanitizeName(name string) string {
+	var b strings.Builder
+
+	for i, r := range name {
+		if i == 0 && r >= '0' && r <= '9' {
+			b.WriteRune('_')
+		}
+		if r == '_' || (r >= 'A' && r <= 'Z') || (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+		} else {
+			b.WriteRune('_')
+		}
+	}
+
+	if b.Len() == 0 {
+		return "_"
+	}
+
+	return b.String()
+}
+
+// CollisionPolicy determines how distinct document paths that flatten to the same key name are handled (e.g. both
+// `a_b` and `a.b` flatten to `A_B`).
+type CollisionPolicy string
+
+const (
+	// CollisionError causes flattening to fail if a key name collision is found.
+	CollisionError CollisionPolicy = "error"
+	// CollisionFirst keeps the value that appears first in the data.
+	CollisionFirst CollisionPolicy = "first"
+	// CollisionLast keeps the value that appears last in the data.
+	CollisionLast CollisionPolicy = "last"
+)
+
+// CollisionPolicies returns the names of all collision policies.
+func CollisionPolicies() []string {
+	return []string{string(CollisionFirst), string(CollisionLast), string(CollisionError)}
+}
+
+// ParseCollisionPolicy returns the CollisionPolicy identified by name. A blank name resolves to CollisionError.
+func ParseCollisionPolicy(name string) (CollisionPolicy, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		return CollisionError, nil
+	}
+
+	for _, p := range CollisionPolicies() {
+		if p == name {
+			return CollisionPolicy(p), nil
+		}
+	}
+
+	return CollisionError, fmt.Errorf("unsupported collision policy: %s", name)
+}
+
+// KeyCase determines the case of path elements in flattened key names.
+type KeyCase string
+
+const (
+	// CaseUpper converts path elements to uppercase (e.g. `new_relic.app` flattens to `NEW_RELIC_APP`).
+	CaseUpper KeyCase = "upper"
+	// CaseLower converts path elements to lowercase.
+	CaseLower KeyCase = "lower"
+	// CasePreserve leaves path elements as they appear in the data.
+	CasePreserve KeyCase = "preserve"
+)
+
+// DefaultKeySeparator is the separator used to join path elements in flattened key names when no separator has been
+// specified.
+const DefaultKeySeparator = "_"
+
+// KeyCases returns the names of all key cases.
+func KeyCases() []string {
+	return []string{string(CaseUpper), string(CaseLower), string(CasePreserve)}
+}
+
+// ParseKeyCase returns the KeyCase identified by name. A blank name resolves to CaseUpper.
+func ParseKeyCase(name string) (KeyCase, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		return CaseUpper, nil
+	}
+
+	for _, c := range KeyCases() {
+		if c == name {
+			return KeyCase(c), nil
+		}
+	}
+
+	return CaseUpper, fmt.Errorf("unsupported key case: %s", name)
+}
+
+// ArrayOption combines an ArrayPolicy with the separator used by the ArrayJoin policy.
+type ArrayOption struct {
+	Policy    ArrayPolicy
+	Separator string
+}
+
+// Options configures how data is flattened. The zero value joins uppercase path elements with underscores, flattens
+// arrays with the ArrayIndexed policy, null values with the NullEmpty policy, booleans with the BoolTrueFalse format,
+// numbers exactly as they appear in the data, passes invalid names through with the NameAllow policy and rejects name
+// collisions with the CollisionError policy.
+type Options struct {
+	// Separator joins path elements in flattened key names. DefaultKeySeparator is used if not specified.
+	Separator string
+	// Case is the case applied to path elements in flattened key names.
+	Case KeyCase
+	// StripPrefix is removed from the beginning of each flattened key name that starts with it.
+	StripPrefix string
+	// Prefix is prepended to each flattened key name, after StripPrefix has been removed.
+	Prefix string
+	// Arrays is the array option applied to all arrays without a key specific option.
+	Arrays ArrayOption
+	// ArraysByKey maps flattened key names (e.g. `HOSTS`) to array options that override Arrays. Key names are matched
+	// before StripPrefix and Prefix are applied.
+	ArraysByKey map[string]ArrayOption
+	// Nulls is the null policy applied to null values.
+	Nulls NullPolicy
+	// Booleans is the format applied to boolean values.
+	Booleans BoolFormat
+	// Names is the name policy applied to flattened key names that aren't valid environment variable names. NameAllow
+	// is used if not specified.
+	Names NamePolicy
+	// Collisions is the collision policy applied to distinct paths that flatten to the same key name.
+	Collisions CollisionPolicy
+	// LookupEnv looks up environment variables for the DirectiveEnv value directive. os.LookupEnv is used if not
+	// specified.
+	LookupEnv func(key string) (string, bool)
+	// ReadFile reads files for the DirectiveFile value directive. ioutil.ReadFile is used if not specified.
+	ReadFile func(filename string) ([]byte, error)
+	// FloatFormat is a printf style format (e.g. `%.2f`) applied to numbers with a fraction or exponent. Numbers are
+	// flattened exactly as they appear in the data if not specified.
+	FloatFormat string
+}
+
+// keyName returns the flattened key name for a path element of the parent key name, with the separator and case
+// applied.
+func (o Options) keyName(parent, key string) string {
+	switch o.Case {
+	case CaseLower:
+		key = strings.ToLower(key)
+	case CasePreserve:
+		// keys are used as they appear in the data
+	default:
+		key = strings.ToUpper(key)
+	}
+
+	if parent == "" {
+		return key
+	}
+
+	separator := o.Separator
+	if separator == "" {
+		separator = DefaultKeySeparator
+	}
+
+	return parent + separator + key
+}
+
+// prefixed returns the flattened key name with StripPrefix removed and Prefix prepended.
+func (o Options) prefixed(keyName string) string {
+	if o.StripPrefix != "" {
+		keyName = strings.TrimPrefix(keyName, o.StripPrefix)
+	}
+
+	return o.Prefix + keyName
+}
+
+// arrayOption returns the array option that applies to the flattened key name.
+func (o Options) arrayOption(keyName string) ArrayOption {
+	option, ok := o.ArraysByKey[keyName]
+	if !ok {
+		option = o.Arrays
+	}
+
+	if option.Policy == "" {
+		option.Policy = ArrayIndexed
+	}
+	if option.Policy == ArrayJoin && option.Separator == "" {
+		option.Separator = DefaultArraySeparator
+	}
+
+	return option
+}
+
+// valueToString returns the string representation of a scalar value with boolean and float formats applied.
+func (o Options) valueToString(value interface{}) string {
+	switch v := value.(type) {
+	case bool:
+		switch o.Booleans {
+		case BoolOneZero:
+			if v {
+				return "1"
+			}
+			return "0"
+		case BoolYesNo:
+			if v {
+				return "yes"
+			}
+			return "no"
+		}
+	case json.Number:
+		if o.FloatFormat != "" && strings.ContainsAny(v.String(), ".eE") {
+			if f, err := v.Float64(); err == nil {
+				return fmt.Sprintf(o.FloatFormat, f)
+			}
+		}
+	}
+
+	return ValueToString(value)
+}
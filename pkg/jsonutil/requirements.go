@@ -0,0 +1,105 @@
+package jsonutil
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/hjson/hjson-go/v4"
+)
+
+// ApplyDefaults returns the key/value pairs followed by a pair for each default whose name wasn't generated. The
+// defaults are described by a data tree object that maps names to strings, numbers, booleans or value directives,
+// found at path. Like names generated from the document, default names are prefixed (see Options) before they're
+// compared with the generated names. A name that was generated with a null value, even one to be unset, isn't replaced
+// by its default.
+func ApplyDefaults(list []KeyValue, defaults interface{}, path string, options Options) ([]KeyValue, error) {
+	object, ok := defaults.(*hjson.OrderedMap)
+	if !ok {
+		return list, fmt.Errorf("defaults must be an object")
+	}
+
+	generated := make(map[string]bool, len(list))
+	for _, kv := range list {
+		generated[kv.Key] = true
+	}
+
+	s := append(make([]KeyValue, 0, len(list)+object.Len()), list...)
+	for _, key := range object.Keys {
+		valuePath := JoinPath(path, key)
+
+		// The name is resolved before the value is decoded so that a default for a generated name is never an error.
+		kv, err := _newKeyValue(KeyValue{Key: key, Path: valuePath}, options)
+		if err != nil {
+			return list, err
+		}
+		if generated[kv.Key] {
+			continue
+		}
+
+		value := object.Map[key]
+		if kv.Value, kv.Literal, err = DecodeDirective(value, valuePath, options); err != nil {
+			return list, err
+		}
+		if !kv.Literal {
+			switch value.(type) {
+			case *hjson.OrderedMap, []interface{}:
+				return list, fmt.Errorf("default must be a string, number or boolean: %s", valuePath)
+			}
+			kv.Value = options.valueToString(value)
+		}
+
+		generated[kv.Key] = true
+		s = append(s, kv)
+	}
+
+	return s, nil
+}
+
+// ParseRequired returns the names listed by a data tree array of strings found at path.
+func ParseRequired(required interface{}, path string) ([]string, error) {
+	list, ok := required.([]interface{})
+	if !ok {
+		return []string{}, fmt.Errorf("%s must be an array of strings", path)
+	}
+
+	names := make([]string, 0, len(list))
+	for i, item := range list {
+		name, ok := item.(string)
+		if !ok {
+			return []string{}, fmt.Errorf("%s must be an array of strings: %s", path, JoinPath(path, strconv.Itoa(i)))
+		}
+		names = append(names, name)
+	}
+
+	return names, nil
+}
+
+// Missing returns the required names, in order and without duplicates, that aren't set by the key/value pairs or, if
+// isSet is not nil, by isSet (e.g. to check an inherited environment). Pairs to be unset don't set their name. Like
+// default names (see ApplyDefaults), required names are prefixed (see Options) before they're checked and the prefixed
+// names are returned.
+func Missing(list []KeyValue, required []string, isSet func(name string) bool, options Options) []string {
+	set := make(map[string]bool, len(list))
+	for _, kv := range list {
+		set[kv.Key] = !kv.Unset
+	}
+
+	missing := make([]string, 0)
+	reported := make(map[string]bool)
+	for _, name := range required {
+		// An invalid name is rejected by the NameError policy but it can't be set either, so it's reported as is.
+		kv, _ := _newKeyValue(KeyValue{Key: name}, options)
+		name = kv.Key
+
+		present, generated := set[name]
+		if !generated && isSet != nil {
+			present = isSet(name)
+		}
+		if !present && !reported[name] {
+			missing = append(missing, name)
+			reported[name] = true
+		}
+	}
+
+	return missing
+}
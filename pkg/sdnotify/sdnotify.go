@@ -0,0 +1,49 @@
+package sdnotify
+
+import (
+	"errors"
+	"net"
+	"os"
+	"strings"
+)
+
+const (
+	// EnvVarNotifySocket is the environment variable set by systemd for services of `Type=notify`.
+	EnvVarNotifySocket = "NOTIFY_SOCKET"
+	// Ready tells the service manager that service startup is finished.
+	Ready = "READY=1"
+	// Stopping tells the service manager that the service is beginning its shutdown.
+	Stopping = "STOPPING=1"
+)
+
+// Socket returns the path of the notification socket from the environment, or an empty string if not set.
+func Socket() string {
+	return os.Getenv(EnvVarNotifySocket)
+}
+
+// Notify sends the state string to the service manager notification socket at the given path. A path beginning with
+// the `@` character identifies a socket in the abstract namespace (linux only).
+//
+// See: https://www.freedesktop.org/software/systemd/man/sd_notify.html
+func Notify(socketPath, state string) error {
+	if strings.TrimSpace(socketPath) == "" {
+		return errors.New("invalid notify socket")
+	}
+
+	addr := &net.UnixAddr{Name: socketPath, Net: "unixgram"}
+	if strings.HasPrefix(socketPath, "@") {
+		addr.Name = "\x00" + socketPath[1:]
+	}
+
+	conn, err := net.DialUnix(addr.Net, nil, addr)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	_, err = conn.Write([]byte(state))
+
+	return err
+}
@@ -0,0 +1,42 @@
+package sdnotify_test
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/markeissler/injector/pkg/sdnotify"
+)
+
+func TestSdNotify_Notify(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sdnotify")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	socketPath := filepath.Join(dir, "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socketPath, Net: "unixgram"})
+	require.NoError(t, err)
+	defer conn.Close()
+
+	require.NoError(t, sdnotify.Notify(socketPath, sdnotify.Ready))
+	require.NoError(t, sdnotify.Notify(socketPath, sdnotify.Stopping))
+
+	buf := make([]byte, 64)
+	n, err := conn.Read(buf)
+	require.NoError(t, err)
+	assert.Equal(t, sdnotify.Ready, string(buf[:n]))
+
+	n, err = conn.Read(buf)
+	require.NoError(t, err)
+	assert.Equal(t, sdnotify.Stopping, string(buf[:n]))
+}
+
+func TestSdNotify_Notify_InvalidSocket(t *testing.T) {
+	assert.Error(t, sdnotify.Notify("", sdnotify.Ready))
+	assert.Error(t, sdnotify.Notify(filepath.Join(os.TempDir(), "sdnotify-missing.sock"), sdnotify.Ready))
+}
@@ -0,0 +1,225 @@
+package secretfiles
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/hjson/hjson-go/v4"
+
+	"github.com/markeissler/injector/pkg/jsonutil"
+)
+
+// Mode is the permission mode of materialized files.
+const Mode os.FileMode = 0400
+
+// File is a secret value to be written to a file whose path is exported in the environment variable named by EnvVar.
+type File struct {
+	EnvVar  string
+	Name    string
+	Content []byte
+}
+
+// Parse returns the files described by a `files` section of a data tree. Each property names the environment variable
+// that will be set to the path of the file and its value describes the file contents:
+//
+// ```json
+// {
+//     "TLS_KEY_FILE": { "$base64": "LS0tLS1CRUdJTi..." },
+//     "GOOGLE_APPLICATION_CREDENTIALS": {
+//         "name": "gcp.json",
+//         "content": { "type": "service_account", "project_id": "..." }
+//     }
+// }
+// ```
+//
+// Contents can be a string, a value directive (see jsonutil.DecodeDirective), or any other value, which is written as
+// JSON. An object with a `content` property can also specify the file `name`, which defaults to the environment
+// variable name.
+func Parse(data interface{}, path string, options jsonutil.Options) ([]File, error) {
+	object, ok := data.(*hjson.OrderedMap)
+	if !ok {
+		return []File{}, fmt.Errorf("files must be an object")
+	}
+
+	files := make([]File, 0, object.Len())
+	names := make(map[string]string, object.Len())
+	for _, key := range object.Keys {
+		filePath := jsonutil.JoinPath(path, key)
+		if !jsonutil.IsValidName(key) {
+			return []File{}, fmt.Errorf("invalid environment variable name: %s (from %s)", key, filePath)
+		}
+
+		file := File{EnvVar: key, Name: key}
+		value := object.Map[key]
+
+		if spec, ok := value.(*hjson.OrderedMap); ok {
+			if content, ok := spec.Map["content"]; ok {
+				value = content
+				if name, ok := spec.Map["name"]; ok {
+					if file.Name, ok = name.(string); !ok {
+						return []File{}, fmt.Errorf("file name must be a string: %s", filePath)
+					}
+				}
+			}
+		}
+
+		if file.Name == "" || file.Name != filepath.Base(file.Name) || file.Name == "." || file.Name == ".." {
+			return []File{}, fmt.Errorf("invalid file name: %s (from %s)", file.Name, filePath)
+		}
+
+		if previous, ok := names[file.Name]; ok {
+			return []File{}, fmt.Errorf("duplicate file name: %s (from %s and %s)", file.Name, previous, filePath)
+		}
+		names[file.Name] = filePath
+
+		content, err := fileContent(value, filePath, options)
+		if err != nil {
+			return []File{}, err
+		}
+		file.Content = content
+
+		files = append(files, file)
+	}
+
+	return files, nil
+}
+
+// fileContent returns the contents of a file described by value.
+func fileContent(value interface{}, path string, options jsonutil.Options) ([]byte, error) {
+	if decoded, ok, err := jsonutil.DecodeDirective(value, path, options); ok {
+		return []byte(decoded), err
+	}
+
+	if s, ok := value.(string); ok {
+		return []byte(s), nil
+	}
+
+	return jsonutil.Marshal(value)
+}
+
+// DefaultBaseDir returns the directory in which materialized files are written by default, preferring memory backed
+// file systems: the user's runtime directory (`$XDG_RUNTIME_DIR`), `/dev/shm`, or the system temporary directory.
+func DefaultBaseDir() string {
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return dir
+	}
+
+	if info, err := os.Stat("/dev/shm"); err == nil && info.IsDir() {
+		return "/dev/shm"
+	}
+
+	return os.TempDir()
+}
+
+// Owner identifies the user and group that will own materialized files. A value of -1 leaves the owner unchanged.
+type Owner struct {
+	UID int
+	GID int
+}
+
+// CurrentOwner leaves ownership of materialized files with the current user.
+var CurrentOwner = Owner{UID: -1, GID: -1}
+
+// ParseOwner returns the Owner identified by spec, a user name or id optionally followed by a colon and a group name or
+// id (e.g. `app:app` or `1000`). The user's primary group is used if no group is specified. A blank spec resolves to
+// CurrentOwner.
+func ParseOwner(spec string) (Owner, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return CurrentOwner, nil
+	}
+
+	parts := strings.SplitN(spec, ":", 2)
+
+	u, err := user.Lookup(parts[0])
+	if err != nil {
+		if u, err = user.LookupId(parts[0]); err != nil {
+			return CurrentOwner, fmt.Errorf("unknown user: %s", parts[0])
+		}
+	}
+
+	gid := u.Gid
+	if len(parts) == 2 {
+		var g *user.Group
+		if g, err = user.LookupGroup(parts[1]); err != nil {
+			if g, err = user.LookupGroupId(parts[1]); err != nil {
+				return CurrentOwner, fmt.Errorf("unknown group: %s", parts[1])
+			}
+		}
+		gid = g.Gid
+	}
+
+	owner := Owner{}
+	if owner.UID, err = strconv.Atoi(u.Uid); err != nil {
+		return CurrentOwner, fmt.Errorf("unsupported user id: %s", u.Uid)
+	}
+	if owner.GID, err = strconv.Atoi(gid); err != nil {
+		return CurrentOwner, fmt.Errorf("unsupported group id: %s", gid)
+	}
+
+	return owner, nil
+}
+
+// Dir is a private directory containing materialized files.
+type Dir struct {
+	Path string
+}
+
+// Materialize writes the files to a new private directory created within baseDir and returns the directory. Files are
+// written with Mode permissions and, like the directory, are owned by owner. The directory should be removed with
+// Remove when the files are no longer needed; it's removed before returning if an error occurs.
+func Materialize(baseDir string, files []File, owner Owner) (*Dir, error) {
+	path, err := ioutil.TempDir(baseDir, "injector-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create files directory: %v", err)
+	}
+	dir := &Dir{Path: path}
+
+	if err = dir.write(files, owner); err != nil {
+		_ = dir.Remove()
+		return nil, err
+	}
+
+	return dir, nil
+}
+
+// write writes the files to the directory.
+func (d *Dir) write(files []File, owner Owner) error {
+	if err := os.Lchown(d.Path, owner.UID, owner.GID); err != nil {
+		return fmt.Errorf("failed to change owner of files directory: %v", err)
+	}
+
+	for _, file := range files {
+		f, err := os.OpenFile(d.FilePath(file), os.O_WRONLY|os.O_CREATE|os.O_EXCL, Mode)
+		if err != nil {
+			return fmt.Errorf("failed to create file %s: %v", file.Name, err)
+		}
+		if _, err = f.Write(file.Content); err != nil {
+			_ = f.Close()
+			return fmt.Errorf("failed to write file %s: %v", file.Name, err)
+		}
+		if err = f.Close(); err != nil {
+			return fmt.Errorf("failed to write file %s: %v", file.Name, err)
+		}
+		if err = os.Lchown(d.FilePath(file), owner.UID, owner.GID); err != nil {
+			return fmt.Errorf("failed to change owner of file %s: %v", file.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// FilePath returns the path of the file within the directory.
+func (d *Dir) FilePath(file File) string {
+	return filepath.Join(d.Path, file.Name)
+}
+
+// Remove removes the directory and all of the files within it.
+func (d *Dir) Remove() error {
+	return os.RemoveAll(d.Path)
+}
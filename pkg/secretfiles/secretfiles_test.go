@@ -0,0 +1,101 @@
+package secretfiles_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/markeissler/injector/pkg/jsonutil"
+	"github.com/markeissler/injector/pkg/secretfiles"
+)
+
+func TestSecretFiles_Parse(t *testing.T) {
+	data, err := jsonutil.Parse([]byte(`{
+		files: {
+			TLS_KEY_FILE: { $base64: "a2V5" }
+			NOTE: "plain"
+			GOOGLE_APPLICATION_CREDENTIALS: {
+				name: "gcp.json"
+				content: { type: "service_account", project_id: "app" }
+			}
+		}
+	}`))
+	require.NoError(t, err)
+
+	section, _ := jsonutil.Get(data, "files")
+	files, err := secretfiles.Parse(section, "files", jsonutil.Options{})
+	require.NoError(t, err)
+
+	expected := []secretfiles.File{
+		{EnvVar: "TLS_KEY_FILE", Name: "TLS_KEY_FILE", Content: []byte("key")},
+		{EnvVar: "NOTE", Name: "NOTE", Content: []byte("plain")},
+		{
+			EnvVar:  "GOOGLE_APPLICATION_CREDENTIALS",
+			Name:    "gcp.json",
+			Content: []byte(`{"type":"service_account","project_id":"app"}`),
+		},
+	}
+	assert.Equal(t, expected, files)
+}
+
+func TestSecretFiles_Parse_Errors(t *testing.T) {
+	tests := []struct {
+		document string
+		expected string
+	}{
+		{`{ "tls-key": "x" }`, "invalid environment variable name: tls-key (from files.tls-key)"},
+		{`{ A: { name: "../a", content: "x" } }`, "invalid file name: ../a (from files.A)"},
+		{`{ A: { name: "b", content: "x" }, b: "y" }`, "duplicate file name: b (from files.A and files.b)"},
+	}
+
+	for _, tt := range tests {
+		data, err := jsonutil.Parse([]byte(tt.document))
+		require.NoError(t, err)
+
+		_, err = secretfiles.Parse(data, "files", jsonutil.Options{})
+		assert.EqualError(t, err, tt.expected)
+	}
+}
+
+func TestSecretFiles_Materialize(t *testing.T) {
+	files := []secretfiles.File{{EnvVar: "TLS_KEY_FILE", Name: "tls.key", Content: []byte("key")}}
+
+	dir, err := secretfiles.Materialize(t.TempDir(), files, secretfiles.CurrentOwner)
+	require.NoError(t, err)
+
+	path := dir.FilePath(files[0])
+	assert.Equal(t, filepath.Join(dir.Path, "tls.key"), path)
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, secretfiles.Mode, info.Mode().Perm())
+
+	info, err = os.Stat(dir.Path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0700), info.Mode().Perm())
+
+	content, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "key", string(content))
+
+	require.NoError(t, dir.Remove())
+	_, err = os.Stat(dir.Path)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestSecretFiles_ParseOwner(t *testing.T) {
+	owner, err := secretfiles.ParseOwner("")
+	require.NoError(t, err)
+	assert.Equal(t, secretfiles.CurrentOwner, owner)
+
+	owner, err = secretfiles.ParseOwner("0:0")
+	require.NoError(t, err)
+	assert.Equal(t, secretfiles.Owner{UID: 0, GID: 0}, owner)
+
+	_, err = secretfiles.ParseOwner("no-such-user-injector")
+	assert.Error(t, err)
+}
@@ -1,8 +1,73 @@
 package stringutil
 
-import "strings"
+import (
+	"strings"
+)
 
 // IsBlank returns true if a string has a non-zero length and doesn't contain only spaces.
 func IsBlank(s string) bool {
 	return strings.TrimSpace(s) == ""
 }
+
+// Expand replaces `${NAME}` references in s with the values returned by lookup, where NAME consists of letters,
+// digits and underscores. `$${NAME}` is replaced with a literal `${NAME}`. Any other text, including `$NAME`, `$$` and
+// references to names that lookup can't find, is left as is so that arguments written for a shell (e.g. `sh -c 'echo
+// $f'`) pass through unchanged. The second return value is true if any references were replaced.
+func Expand(s string, lookup func(name string) (string, bool)) (string, bool) {
+	var b strings.Builder
+	expanded := false
+
+	for i := 0; i < len(s); i++ {
+		if s[i] != '$' {
+			b.WriteByte(s[i])
+			continue
+		}
+
+		if strings.HasPrefix(s[i+1:], "${") {
+			if name, ok := referenceName(s[i+1:]); ok {
+				b.WriteString(s[i+1 : i+4+len(name)])
+				i += len(name) + 3
+				continue
+			}
+		}
+
+		name, ok := referenceName(s[i:])
+		if !ok {
+			b.WriteByte(s[i])
+			continue
+		}
+		value, found := lookup(name)
+		if !found {
+			b.WriteByte(s[i])
+			continue
+		}
+		b.WriteString(value)
+		expanded = true
+		i += len(name) + 2
+	}
+
+	return b.String(), expanded
+}
+
+// referenceName returns the name of the `${NAME}` reference at the start of s.
+func referenceName(s string) (string, bool) {
+	if !strings.HasPrefix(s, "${") {
+		return "", false
+	}
+	end := strings.IndexByte(s, '}')
+	if end <= 2 {
+		return "", false
+	}
+	for i := 2; i < end; i++ {
+		if !isNameByte(s[i]) {
+			return "", false
+		}
+	}
+
+	return s[2:end], true
+}
+
+// isNameByte returns true if c can appear in a reference name.
+func isNameByte(c byte) bool {
+	return c == '_' || (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9')
+}
@@ -17,3 +17,41 @@ func TestStringUtil_IsBlank(t *testing.T) {
 	assert.True(t, stringutil.IsBlank(strings.Repeat(" ", 5)), "string of spaces")
 	assert.True(t, stringutil.IsBlank(""), "zero length string")
 }
+
+func TestStringUtil_Expand(t *testing.T) {
+	lookup := func(name string) (string, bool) {
+		value, ok := map[string]string{"DB_PASSWORD": "s3cret", "PORT": "5432"}[name]
+		return value, ok
+	}
+
+	s, expanded := stringutil.Expand("--password=${DB_PASSWORD}", lookup)
+	assert.True(t, expanded)
+	assert.Equal(t, "--password=s3cret", s)
+
+	s, expanded = stringutil.Expand("${PORT}0 and $${PORT}", lookup)
+	assert.True(t, expanded)
+	assert.Equal(t, "54320 and ${PORT}", s)
+
+	s, expanded = stringutil.Expand("--verbose", lookup)
+	assert.False(t, expanded)
+	assert.Equal(t, "--verbose", s)
+}
+
+func TestStringUtil_Expand_Unrelated(t *testing.T) {
+	lookup := func(name string) (string, bool) {
+		value, ok := map[string]string{"PORT": "5432"}[name]
+		return value, ok
+	}
+
+	for _, arg := range []string{
+		"echo $f",
+		"for f in *; do echo ${f}; done",
+		"echo $PORT costs $$5 or $ 5",
+		"echo ${PORT:-80} ${PORT",
+		"$",
+	} {
+		s, expanded := stringutil.Expand(arg, lookup)
+		assert.False(t, expanded, arg)
+		assert.Equal(t, arg, s)
+	}
+}
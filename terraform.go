@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/markeissler/injector/format"
+	"github.com/markeissler/injector/gcp"
+	"github.com/markeissler/injector/pkg/jsonutil"
+	"github.com/markeissler/injector/pkg/stringutil"
+)
+
+// terraformQuery represents the query object passed by Terraform to an external data source program. Query values
+// take precedence over the corresponding cli options and environment variables.
+type terraformQuery struct {
+	Project string `json:"project"`
+	Secret  string `json:"secret"`
+	Version string `json:"version"`
+}
+
+// terraformCommand defines the command that implements the Terraform external data source program protocol.
+//
+// See: https://registry.terraform.io/providers/hashicorp/external/latest/docs/data-sources/data_source
+func terraformCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "terraform-external",
+		Usage: "Run as a Terraform external data source program.",
+		Description: "Reads a JSON query object (project, secret, version) from stdin and writes the flattened " +
+			"environment variable names and values as a JSON object to stdout.",
+		Action: runTerraform,
+	}
+}
+
+// runTerraform is the main loop for the `terraform-external` command. Terraform surfaces the stderr output of a failed
+// program to the user so errors are written to stderr without any log formatting.
+func runTerraform(ctx *cli.Context) error {
+	if err := terraformExternal(ctx, ctx.App.Reader, ctx.App.Writer); err != nil {
+		return cli.Exit(err.Error(), 1)
+	}
+
+	return nil
+}
+
+// terraformExternal reads the Terraform query from the io.Reader, retrieves the secret manager document identified by
+// the query and writes its flattened contents to the io.Writer as a JSON object of string values.
+func terraformExternal(ctx *cli.Context, reader io.Reader, writer io.Writer) error {
+	if bad, err := hasConflictingOptions(ctx); bad {
+		return err
+	}
+
+	query := terraformQuery{
+		Project: ctx.String("project"),
+		Secret:  ctx.String("secret-name"),
+		Version: ctx.String("secret-version"),
+	}
+
+	decoder := json.NewDecoder(reader)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&query); err != nil {
+		return fmt.Errorf("failed to parse query: %v", err)
+	}
+
+	if stringutil.IsBlank(query.Project) || stringutil.IsBlank(query.Secret) {
+		return errors.New("query must specify both project and secret")
+	}
+
+	var buf bytes.Buffer
+	request := gcp.SecretRequest{
+		KeyFile:  ctx.String("key-file"),
+		KeyValue: ctx.String("key-value"),
+		Project:  query.Project,
+		Name:     query.Secret,
+		Version:  query.Version,
+	}
+	if err := fetchSecret(ctx.Context, request, &buf); err != nil {
+		return err
+	}
+
+	data, err := parseSecretDocument(ctx, request, &buf)
+	if err != nil {
+		return fmt.Errorf("failed to parse secret document: %v", err)
+	}
+
+	var list []jsonutil.KeyValue
+	if list, err = flattenDocument(ctx, data); err != nil {
+		return err
+	}
+	if err = checkRequired(ctx, data, list, nil); err != nil {
+		return err
+	}
+
+	return format.WriteKeyValues(writer, format.JSON, list)
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v2"
+
+	"github.com/markeissler/injector/gcp"
+)
+
+// runTerraformTest runs the terraform-external command, after the global options in args, with the query on stdin and
+// secret documents fetched from documents, keyed by secret name. It returns stdout, stderr, the exit code and the
+// fetch requests.
+func runTerraformTest(query string, documents map[string]string, args ...string) (string, string, int, []gcp.SecretRequest) {
+	requests, restore := stubFetchSecret(documents)
+	defer restore()
+
+	var stdout, stderr bytes.Buffer
+	code := 0
+	exiter, errWriter := cli.OsExiter, cli.ErrWriter
+	cli.OsExiter = func(c int) { code = c }
+	cli.ErrWriter = &stderr
+	defer func() {
+		cli.OsExiter, cli.ErrWriter = exiter, errWriter
+	}()
+
+	app := newApp()
+	app.Reader = strings.NewReader(query)
+	app.Writer = &stdout
+	app.ErrWriter = &stderr
+	_ = app.Run(append(append([]string{appName, "--key-file", "key.json"}, args...), "terraform-external"))
+
+	return stdout.String(), stderr.String(), code, *requests
+}
+
+func TestTerraform_External(t *testing.T) {
+	documents := map[string]string{
+		"app": `{
+			environment: {
+				db: { host: "db.example.com", port: 5432 }
+				debug: true
+				ratio: 0.5
+			}
+		}`,
+	}
+
+	stdout, stderr, code, requests := runTerraformTest(`{"project": "my-project", "secret": "app", "version": "3"}`,
+		documents)
+	require.Equal(t, 0, code, stderr)
+	assert.Empty(t, stderr)
+	assert.Equal(t, []gcp.SecretRequest{{KeyFile: "key.json", Project: "my-project", Name: "app", Version: "3"}}, requests)
+	assert.JSONEq(t, `{"DB_HOST": "db.example.com", "DB_PORT": "5432", "DEBUG": "true", "RATIO": "0.5"}`, stdout)
+}
+
+func TestTerraform_External_Query(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		expected string
+	}{
+		{
+			name:     "invalid JSON",
+			query:    `{"project": "my-project",`,
+			expected: "failed to parse query: unexpected EOF\n",
+		},
+		{
+			name:  "non-string value",
+			query: `{"project": "my-project", "secret": "app", "version": 3}`,
+			expected: "failed to parse query: json: cannot unmarshal number into Go struct field " +
+				"terraformQuery.version of type string\n",
+		},
+		{
+			name:     "unknown key",
+			query:    `{"project": "my-project", "secret": "app", "region": "us"}`,
+			expected: "failed to parse query: json: unknown field \"region\"\n",
+		},
+		{
+			name:     "missing secret",
+			query:    `{"project": "my-project"}`,
+			expected: "query must specify both project and secret\n",
+		},
+		{
+			name:     "fetch failure",
+			query:    `{"project": "my-project", "secret": "missing"}`,
+			expected: "secret not found: missing\n",
+		},
+	}
+
+	for _, tt := range tests {
+		stdout, stderr, code, _ := runTerraformTest(tt.query, map[string]string{"app": `{}`})
+		assert.Equal(t, 1, code, tt.name)
+		assert.Equal(t, tt.expected, stderr, tt.name)
+		assert.Empty(t, stdout, tt.name)
+	}
+}
+
+func TestTerraform_External_RequiredPrefix(t *testing.T) {
+	documents := map[string]string{
+		"app": `{
+			environment: { database_url: "postgres://db.example.com/app" }
+			defaults: { LOG_LEVEL: "info" }
+			required: ["DATABASE_URL", "LOG_LEVEL"]
+		}`,
+	}
+	query := `{"project": "my-project", "secret": "app"}`
+
+	stdout, stderr, code, _ := runTerraformTest(query, documents, "--prefix", "MYAPP_")
+	require.Equal(t, 0, code, stderr)
+	assert.JSONEq(t, `{"MYAPP_DATABASE_URL": "postgres://db.example.com/app", "MYAPP_LOG_LEVEL": "info"}`, stdout)
+
+	_, stderr, code, _ = runTerraformTest(query, documents, "--prefix", "MYAPP_", "--require", "API_TOKEN")
+	assert.Equal(t, 1, code)
+	assert.Equal(t, "missing required environment variables: MYAPP_API_TOKEN\n", stderr)
+}
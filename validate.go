@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/markeissler/injector/gcp"
+	"github.com/markeissler/injector/pkg/jsonschema"
+	"github.com/markeissler/injector/pkg/stringutil"
+)
+
+// validateCommand defines the command that validates a secret document against a JSON Schema, e.g. as a CI check.
+func validateCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "validate",
+		Usage:     "Validate the secret document against a JSON Schema.",
+		ArgsUsage: "[FILE]",
+		Description: "Validates the secret document specified by the global options, or read from FILE, against the JSON " +
+			"Schema specified by the schema-file or schema-secret option and writes each error to stdout.",
+		Action: runValidate,
+	}
+}
+
+// runValidate is the main loop for the `validate` command. Errors are written without any log formatting so that they
+// read well in CI logs.
+func runValidate(ctx *cli.Context) error {
+	if err := validate(ctx, os.Stdout); err != nil {
+		return cli.Exit(err.Error(), 1)
+	}
+
+	return nil
+}
+
+// readCommandDocument reads the secret manager document for a command into the buffer, from the file named by the
+// command argument or, if no argument has been specified, from secret manager as specified by the global options.
+func readCommandDocument(ctx *cli.Context, buf *bytes.Buffer) error {
+	switch ctx.Args().Len() {
+	case 0:
+		if bad, err := hasMissingRetrievalOptions(ctx); bad {
+			return err
+		}
+		if !wantsToPullSecret(ctx) {
+			return errors.New("no secret document specified")
+		}
+		return fetchSecret(ctx.Context, gcp.NewSecretRequest(ctx), buf)
+	case 1:
+		content, err := ioutil.ReadFile(ctx.Args().First())
+		if err != nil {
+			return fmt.Errorf("failed to read secret document: %v", err)
+		}
+		buf.Write(content)
+		return nil
+	}
+
+	return errors.New("only one secret document can be specified")
+}
+
+// validate reads the secret manager document, from the file named by the command argument or from secret manager, and
+// validates it against the JSON Schema. Each validation error is written to the io.Writer on a separate line.
+func validate(ctx *cli.Context, writer io.Writer) error {
+	if bad, err := hasConflictingOptions(ctx); bad {
+		return err
+	}
+
+	if stringutil.IsBlank(ctx.String("schema-file")) && stringutil.IsBlank(ctx.String("schema-secret")) {
+		return errors.New("schema-file or schema-secret option is required")
+	}
+
+	var buf bytes.Buffer
+	if err := readCommandDocument(ctx, &buf); err != nil {
+		return err
+	}
+
+	_, err := parseHJSON(ctx, &buf)
+
+	var errs jsonschema.ValidationErrors
+	if errors.As(err, &errs) {
+		for _, e := range errs {
+			fmt.Fprintln(writer, e.Error())
+		}
+		return fmt.Errorf("secret document doesn't match schema (%d errors)", len(errs))
+	}
+
+	return err
+}